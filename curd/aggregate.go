@@ -0,0 +1,153 @@
+package curd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+)
+
+// AggregateMaxRows 聚合查询最多返回的分组数
+var AggregateMaxRows = 1000
+
+// aggregateBuckets 按 create_time 分桶的时间格式
+var aggregateBuckets = map[string]string{
+	"hour":  "%Y-%m-%d %H:00",
+	"day":   "%Y-%m-%d",
+	"week":  "%x-%v",
+	"month": "%Y-%m",
+	"year":  "%Y",
+}
+
+// aggregateFuncs 支持的统计函数
+var aggregateFuncs = map[string]string{
+	"sum": "SUM",
+	"avg": "AVG",
+	"min": "MIN",
+	"max": "MAX",
+}
+
+// Aggregatable 模型允许分组和统计的字段白名单
+type Aggregatable interface {
+	AggregateFields() []string
+}
+
+// AggregateAPI 聚合统计服务
+type AggregateAPI interface {
+	Aggregate(params *AggregateParams, model interface{}) ([]map[string]interface{}, error)
+}
+
+// AggregateParams 聚合统计入参，Conditions 与 Search 一致
+type AggregateParams struct {
+	Conditions map[string]interface{} `json:"conditions"`
+	// GroupBy 分组字段
+	GroupBy []string `json:"groupBy"`
+	// Metrics 统计指标，如 count、sum:amount、avg:amount，结果字段名为 count、sum_amount、avg_amount
+	Metrics []string `json:"metrics"`
+	// Bucket 按 create_time 分桶：hour、day、week、month、year，结果字段名为 bucket
+	Bucket string `json:"bucket"`
+}
+
+// Aggregate 分组统计
+func (m *Model) Aggregate(params *AggregateParams, model interface{}) ([]map[string]interface{}, error) {
+	db := conditionQuery(m.db().Model(model), params.Conditions)
+	if m.where != "" {
+		db = db.Where(m.where)
+	}
+	db, metrics, err := aggregateQuery(db, params, model)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0)
+	result := db.Session(&gorm.Session{SkipHooks: true}).Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// DECIMAL 等类型扫描为字符串，统计结果统一转为数字
+	for _, row := range rows {
+		for _, metric := range metrics {
+			if str, ok := row[metric].(string); ok {
+				if n, err := strconv.ParseFloat(str, 64); err == nil {
+					row[metric] = n
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// Aggregate 分组统计
+func (m *ModelIdInt) Aggregate(params *AggregateParams, model interface{}) ([]map[string]interface{}, error) {
+	modelBase := m.base()
+	return modelBase.Aggregate(params, model)
+}
+
+// aggregateQuery 校验字段白名单并生成分组统计语句，返回统计结果字段名
+func aggregateQuery(db *gorm.DB, params *AggregateParams, model interface{}) (*gorm.DB, []string, error) {
+	aggregatable, ok := model.(Aggregatable)
+	if !ok {
+		return db, nil, errors.New("该模型不支持聚合统计")
+	}
+	if len(params.Metrics) == 0 {
+		return db, nil, errors.New("统计指标不能为空")
+	}
+	if err := db.Statement.Parse(model); err != nil {
+		return db, nil, err
+	}
+	allowed := aggregatable.AggregateFields()
+	column := func(name string) (string, error) {
+		field := db.Statement.Schema.LookUpField(name)
+		if field == nil {
+			field = db.Statement.Schema.LookUpField(utils.CamelToLine(name))
+		}
+		if field == nil || field.DBName == "" || !(isInArray(name, allowed) || isInArray(field.DBName, allowed)) {
+			return "", errors.New("不支持统计的字段：" + name)
+		}
+		return field.DBName, nil
+	}
+
+	var selects, groups, metrics []string
+	if params.Bucket != "" {
+		format, ok := aggregateBuckets[params.Bucket]
+		if !ok {
+			return db, nil, errors.New("不支持的时间分桶：" + params.Bucket)
+		}
+		selects = append(selects, "FROM_UNIXTIME(create_time, '"+format+"') AS bucket")
+		groups = append(groups, "bucket")
+	}
+	for _, name := range params.GroupBy {
+		dbName, err := column(name)
+		if err != nil {
+			return db, nil, err
+		}
+		selects = append(selects, dbName)
+		groups = append(groups, dbName)
+	}
+	for _, metric := range params.Metrics {
+		if metric == "count" {
+			selects = append(selects, "COUNT(*) AS count")
+			metrics = append(metrics, "count")
+			continue
+		}
+		parts := strings.SplitN(metric, ":", 2)
+		fn, ok := aggregateFuncs[parts[0]]
+		if !ok || len(parts) != 2 {
+			return db, nil, errors.New("不支持的统计指标：" + metric)
+		}
+		dbName, err := column(parts[1])
+		if err != nil {
+			return db, nil, err
+		}
+		alias := parts[0] + "_" + dbName
+		selects = append(selects, fn+"("+dbName+") AS "+alias)
+		metrics = append(metrics, alias)
+	}
+
+	db = db.Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		db = db.Group(strings.Join(groups, ", ")).Order(strings.Join(groups, ", "))
+	}
+	return db.Limit(AggregateMaxRows), metrics, nil
+}
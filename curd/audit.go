@@ -0,0 +1,160 @@
+package curd
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lijianjunljj/gocommon/utils"
+)
+
+const (
+	AuditAdd    = "add"
+	AuditEdit   = "edit"
+	AuditDelete = "delete"
+)
+
+var auditSink AuditSink
+
+// Auditable 模型是否记录数据变更审计
+type Auditable interface {
+	Audit() bool
+}
+
+// AuditSink 审计记录写入接口
+type AuditSink interface {
+	Write(log *AuditLog) error
+}
+
+// AuditHistory 审计记录查询接口
+type AuditHistory interface {
+	History(model string, recordID string) ([]AuditLog, error)
+}
+
+// JSONMap JSON对象字段
+type JSONMap map[string]interface{}
+
+func (j JSONMap) Value() (driver.Value, error) {
+	return json.Marshal(j)
+}
+
+func (j *JSONMap) Scan(data interface{}) error {
+	return json.Unmarshal(data.([]byte), &j)
+}
+
+// AuditLog 数据变更审计记录
+type AuditLog struct {
+	ID         uint64  `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	Model      string  `json:"model" gorm:"type:varchar(64);index:idx_audit_record"`
+	RecordID   string  `json:"record_id" gorm:"type:varchar(64);index:idx_audit_record"`
+	Operation  string  `json:"operation" gorm:"type:varchar(16)"`
+	UserID     string  `json:"user_id" gorm:"type:varchar(30)"`
+	RequestID  string  `json:"request_id" gorm:"type:varchar(64)"`
+	Before     JSONMap `json:"before" gorm:"type:text"`
+	After      JSONMap `json:"after" gorm:"type:text"`
+	Diff       JSONMap `json:"diff" gorm:"type:text"`
+	CreateTime int64   `json:"create_time"`
+}
+
+// DBAuditSink 审计记录写入数据库，需先 AutoMigrate(&AuditLog{})
+type DBAuditSink struct {
+	// Database 写入的数据库，为 db.Register 注册的名称，为空时使用默认数据库
+	Database string
+}
+
+// Write 写入审计记录
+func (s *DBAuditSink) Write(log *AuditLog) error {
+	return databaseDB(s.Database).Create(log).Error
+}
+
+// History 查询单条记录的变更历史
+func (s *DBAuditSink) History(model string, recordID string) ([]AuditLog, error) {
+	var logs []AuditLog
+	result := databaseDB(s.Database).Where("model = ? AND record_id = ?", model, recordID).Order("id desc").Find(&logs)
+	return logs, result.Error
+}
+
+// EnableAudit 开启审计，sink 为空时写入数据库审计表
+func EnableAudit(sink AuditSink) {
+	if sink == nil {
+		sink = &DBAuditSink{}
+	}
+	auditSink = sink
+}
+
+// isAuditable 模型是否需要记录审计
+func isAuditable(model interface{}) bool {
+	auditable, ok := model.(Auditable)
+	return ok && auditable.Audit() && auditSink != nil
+}
+
+// modelName 模型名称
+func modelName(model interface{}) string {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// snapshot 模型数据快照
+func snapshot(model interface{}) JSONMap {
+	if model == nil {
+		return nil
+	}
+	return utils.StructToMap(model)
+}
+
+// diffSnapshot 字段级差异，值为 {"old":旧值,"new":新值}
+func diffSnapshot(before JSONMap, after JSONMap) JSONMap {
+	diff := make(JSONMap)
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			diff[key] = map[string]interface{}{"old": before[key], "new": value}
+		}
+	}
+	for key, old := range before {
+		if _, ok := after[key]; !ok {
+			diff[key] = map[string]interface{}{"old": old, "new": nil}
+		}
+	}
+	return diff
+}
+
+// audit 记录审计，在外层事务中时等模型所在数据库的事务提交后写入，回滚的操作不留记录
+func (l *Logic) audit(operation string, model interface{}, before interface{}, after interface{}) {
+	log := newAuditLog(l.svc.Ctx, operation, model, before, after)
+	afterDatabaseCommit(l.opContext(), databaseName(model), func() {
+		writeAudit(log)
+	})
+}
+
+// newAuditLog 生成审计记录，前后快照在调用时生成
+func newAuditLog(ctx *gin.Context, operation string, model interface{}, before interface{}, after interface{}) *AuditLog {
+	log := &AuditLog{
+		Model:      modelName(model),
+		RecordID:   utils.ToStr(reflect.ValueOf(model).Elem().FieldByName("ID").Interface()),
+		Operation:  operation,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+		CreateTime: utils.TimeUnix(),
+	}
+	log.Diff = diffSnapshot(log.Before, log.After)
+	if ctx != nil {
+		log.UserID = ctx.GetString("userID")
+		log.RequestID = ctx.GetHeader("X-Request-ID")
+		if log.RequestID == "" {
+			log.RequestID = ctx.GetString("requestID")
+		}
+	}
+	return log
+}
+
+// writeAudit 写入审计记录，写入失败不影响业务操作
+func writeAudit(log *AuditLog) {
+	if err := auditSink.Write(log); err != nil {
+		fmt.Println("audit write err:", err)
+	}
+}
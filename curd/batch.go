@@ -0,0 +1,191 @@
+package curd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BatchSize 批量写入时每批条数
+var BatchSize = 100
+
+// BatchAPI 批量操作服务
+type BatchAPI interface {
+	BatchAdd(tx *gorm.DB, models interface{}, batchSize int) error
+	BatchEdit(tx *gorm.DB, model interface{}) error
+	BatchDelete(tx *gorm.DB, model interface{}, ids []string) (int64, error)
+}
+
+// BatchParams 批量操作入参
+type BatchParams struct {
+	Items   json.RawMessage `json:"items"`
+	IDs     IDList          `json:"ids"`
+	Partial bool            `json:"partial"`
+}
+
+// BatchResult 批量操作单条结果
+type BatchResult struct {
+	Index int         `json:"index"`
+	ID    interface{} `json:"id"`
+	Error string      `json:"error,omitempty"`
+}
+
+// BatchResults 批量操作结果
+type BatchResults struct {
+	Success int           `json:"success"`
+	Failed  int           `json:"failed"`
+	Items   []BatchResult `json:"items"`
+}
+
+// IDList ID列表，兼容字符串和数字
+type IDList []string
+
+// UnmarshalJSON 解析字符串或数字ID
+func (ids *IDList) UnmarshalJSON(data []byte) error {
+	var items []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&items); err != nil {
+		return err
+	}
+	list := make(IDList, 0, len(items))
+	for _, item := range items {
+		list = append(list, utils.ToStr(item))
+	}
+	*ids = list
+	return nil
+}
+
+// BatchAdd 批量新增
+func (m *Model) BatchAdd(tx *gorm.DB, models interface{}, batchSize int) error {
+	result := tx.Omit(clause.Associations).CreateInBatches(models, batchSize)
+	return result.Error
+}
+
+// BatchEdit 批量编辑中的单条更新，仅更新非零值字段
+func (m *Model) BatchEdit(tx *gorm.DB, model interface{}) error {
+	if err := m.inScope(tx, model); err != nil {
+		return err
+	}
+	omit, err := immutableColumns(tx, model, m.scopeColumn)
+	if err != nil {
+		return err
+	}
+	tx = tx.Omit(append(omit, clause.Associations)...)
+	if version, ok := versionField(model); ok {
+		return updateWithVersion(tx, model, version)
+	}
+	result := tx.Model(model).Updates(model)
+	return result.Error
+}
+
+// BatchDelete 按ID批量删除，model 为不带ID的模型实例
+func (m *Model) BatchDelete(tx *gorm.DB, model interface{}, ids []string) (int64, error) {
+	var result *gorm.DB
+	if soft, ok := model.(SoftDeleter); ok {
+		if soft.SoftDelete() {
+			mv := reflect.ValueOf(model).Elem()
+			mv.FieldByName("DeletedAt").Set(reflect.ValueOf(gorm.DeletedAt{Time: time.Now(), Valid: true}))
+			result = m.scoped(tx).Model(model).Where(primaryIn(ids)).Select("deleted_at", "delete_by", "delete_time").Updates(model)
+			return result.RowsAffected, result.Error
+		}
+		tx = tx.Unscoped()
+	}
+	result = m.scoped(tx).Where(primaryIn(ids)).Delete(model)
+	return result.RowsAffected, result.Error
+}
+
+// primaryIn 主键在 ids 中的条件，主键列名取自模型结构
+func primaryIn(ids []string) clause.IN {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return clause.IN{Column: clause.PrimaryColumn, Values: values}
+}
+
+// validateItems 按分组逐条校验批量数据，错误字段名带上序号，如 items[0].name；
+// fields 不为空时每条只校验 fields[i] 中的字段
+func validateItems(models interface{}, group string, fields [][]string) error {
+	rows := reflect.Indirect(reflect.ValueOf(models))
+	if rows.Kind() != reflect.Slice {
+		return nil
+	}
+	errs := make(utils.FieldErrors)
+	for i := 0; i < rows.Len(); i++ {
+		var err error
+		if fields != nil {
+			var keys []string
+			if i < len(fields) {
+				keys = fields[i]
+			}
+			err = utils.ValidatePartial(rowAt(rows, i).Interface(), group, keys)
+		} else {
+			err = utils.ValidateGroup(rowAt(rows, i).Interface(), group)
+		}
+		if err == nil {
+			continue
+		}
+		rowErrs, ok := err.(utils.FieldErrors)
+		if !ok {
+			return err
+		}
+		for field, msg := range rowErrs {
+			errs[fmt.Sprintf("items[%d].%s", i, field)] = fmt.Sprintf("第%d条数据：%s", i+1, msg)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// rowTypeOf 模型列表的元素类型，models 须为切片指针，如 &[]Order{} 或 &[]*Order{}
+func rowTypeOf(models interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(models)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil, errors.New("该接口需要模型列表")
+	}
+	rowType := t.Elem().Elem()
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	return rowType, nil
+}
+
+// rowAt 切片中第 i 条数据的指针，兼容 []T 和 []*T
+func rowAt(rows reflect.Value, i int) reflect.Value {
+	row := rows.Index(i)
+	if row.Kind() != reflect.Ptr {
+		return row.Addr()
+	}
+	if row.IsNil() {
+		row.Set(reflect.New(row.Type().Elem()))
+	}
+	return row
+}
+
+// BatchAdd 批量新增
+func (m *ModelIdInt) BatchAdd(tx *gorm.DB, models interface{}, batchSize int) error {
+	modelBase := m.base()
+	return modelBase.BatchAdd(tx, models, batchSize)
+}
+
+// BatchEdit 批量编辑中的单条更新，仅更新非零值字段
+func (m *ModelIdInt) BatchEdit(tx *gorm.DB, model interface{}) error {
+	modelBase := m.base()
+	return modelBase.BatchEdit(tx, model)
+}
+
+// BatchDelete 按ID批量删除，model 为不带ID的模型实例
+func (m *ModelIdInt) BatchDelete(tx *gorm.DB, model interface{}, ids []string) (int64, error) {
+	modelBase := m.base()
+	return modelBase.BatchDelete(tx, model, ids)
+}
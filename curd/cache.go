@@ -0,0 +1,264 @@
+package curd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lijianjunljj/gocommon/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	redisConn func() redis.Conn
+
+	// CachePrefix 缓存键前缀
+	CachePrefix = "curd:"
+
+	cacheGroup singleflight.Group
+)
+
+// WithRedis 设置缓存使用的 Redis 连接，如 curd.WithRedis(misc.GetRedis)
+func WithRedis(redisFunc func() redis.Conn) {
+	redisConn = redisFunc
+}
+
+// CacheConfig 模型缓存配置，TTL 为 0 表示不缓存
+type CacheConfig struct {
+	DetailTTL time.Duration
+	ListTTL   time.Duration
+}
+
+// Cacheable 开启缓存的模型，修改和删除时自动失效
+type Cacheable interface {
+	Cache() CacheConfig
+}
+
+// cacheConfig 模型的缓存配置
+func (l *Logic) cacheConfig() (CacheConfig, bool) {
+	cacheable, ok := l.svc.Model.(Cacheable)
+	if !ok || redisConn == nil {
+		return CacheConfig{}, false
+	}
+	return cacheable.Cache(), true
+}
+
+// detailKey 详情缓存键
+func detailKey(model interface{}, id string) string {
+	return CachePrefix + modelName(model) + ":detail:" + id
+}
+
+// versionKey 列表缓存版本号键，数据变更时递增使所有列表缓存失效
+func versionKey(model interface{}) string {
+	return CachePrefix + modelName(model) + ":version"
+}
+
+// encodeCache 缓存使用 gob 编码，保留 json 忽略的字段
+func encodeCache(values ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCache 解码缓存
+func decodeCache(data []byte, values ...interface{}) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	for _, value := range values {
+		if err := decoder.Decode(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeModel 解码详情缓存，gob 不传输零值，先解码到新实例再复制导出字段，保留模型的查询状态
+func decodeModel(data []byte, model interface{}) error {
+	mv := reflect.ValueOf(model).Elem()
+	cached := reflect.New(mv.Type())
+	if err := decodeCache(data, cached.Interface()); err != nil {
+		return err
+	}
+	for _, field := range reflect.VisibleFields(mv.Type()) {
+		if field.IsExported() && !field.Anonymous {
+			mv.FieldByIndex(field.Index).Set(cached.Elem().FieldByIndex(field.Index))
+		}
+	}
+	return nil
+}
+
+// decodeList 解码列表缓存
+func decodeList(data []byte, count *int64, nextCursor *string, models interface{}) error {
+	rows := reflect.ValueOf(models).Elem()
+	rows.Set(reflect.Zero(rows.Type()))
+	return decodeCache(data, count, nextCursor, models)
+}
+
+// getCache 读取缓存，不存在或出错时返回 nil，出错时回源查询数据库
+func getCache(key string) []byte {
+	conn := redisConn()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil && err != redis.ErrNil {
+		fmt.Println("cache get err:", err)
+	}
+	return data
+}
+
+// setCache 写入缓存
+func setCache(key string, data []byte, ttl time.Duration) {
+	conn := redisConn()
+	defer conn.Close()
+	if _, err := conn.Do("SET", key, data, "PX", ttl.Milliseconds()); err != nil {
+		fmt.Println("cache set err:", err)
+	}
+}
+
+// cachedDetail 按ID读取详情，开启缓存时先读缓存，并发未命中时只查询一次数据库。
+// 有数据范围限制、租户模型或在事务中时不使用缓存，避免读到范围外、其他租户或事务外的数据
+func (l *Logic) cachedDetail() error {
+	config, ok := l.cacheConfig()
+	id := reflect.ValueOf(l.svc.Model).Elem().FieldByName("ID")
+	_, isTenant := l.svc.Model.(tenantAware)
+	if !ok || config.DetailTTL <= 0 || l.scopeKey != "" || isTenant || l.ambientTx() != nil || !id.IsValid() || id.IsZero() {
+		return l.detail()
+	}
+	key := detailKey(l.svc.Model, utils.ToStr(id.Interface()))
+	if data := getCache(key); data != nil {
+		if err := decodeModel(data, l.svc.Model); err == nil {
+			return nil
+		}
+	}
+	executed := false
+	data, err, _ := cacheGroup.Do(key, func() (interface{}, error) {
+		executed = true
+		if err := l.detail(); err != nil {
+			return nil, err
+		}
+		data, err := encodeCache(l.svc.Model)
+		if err != nil {
+			fmt.Println("cache encode err:", err)
+			return nil, nil
+		}
+		setCache(key, data, config.DetailTTL)
+		return data, nil
+	})
+	if err != nil || executed {
+		return err
+	}
+	if data == nil {
+		return l.detail()
+	}
+	return decodeModel(data.([]byte), l.svc.Model)
+}
+
+// cacheKind 列表缓存类型，带钩子的查询结果可能不同，分开缓存
+func cacheKind(kind string, isHook bool) string {
+	if isHook {
+		return kind + "_hook"
+	}
+	return kind
+}
+
+// cachedList 列表查询，开启缓存时按查询参数、数据范围和租户缓存，数据变更后版本号递增失效，在事务中时不使用缓存
+func (l *Logic) cachedList(kind string, search *Search, query func() (int64, error)) (int64, error) {
+	config, ok := l.cacheConfig()
+	if !ok || config.ListTTL <= 0 || l.ambientTx() != nil {
+		return query()
+	}
+	params, err := json.Marshal(search)
+	if err != nil {
+		return query()
+	}
+	conn := redisConn()
+	version, _ := redis.Int64(conn.Do("GET", versionKey(l.svc.Model)))
+	conn.Close()
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%s|%s|%s", kind, version, l.scopeKey, l.tenantKey(), params)))
+	key := CachePrefix + modelName(l.svc.Model) + ":" + kind + ":" + hex.EncodeToString(hash[:])
+
+	var count int64
+	if data := getCache(key); data != nil {
+		if err = decodeList(data, &count, &search.NextCursor, l.models); err == nil {
+			return count, nil
+		}
+	}
+	executed := false
+	data, err, _ := cacheGroup.Do(key, func() (interface{}, error) {
+		executed = true
+		count, err = query()
+		if err != nil {
+			return nil, err
+		}
+		data, err := encodeCache(count, search.NextCursor, l.models)
+		if err != nil {
+			fmt.Println("cache encode err:", err)
+			return nil, nil
+		}
+		setCache(key, data, config.ListTTL)
+		return data, nil
+	})
+	if err != nil || executed {
+		return count, err
+	}
+	if data == nil {
+		return query()
+	}
+	err = decodeList(data.([]byte), &count, &search.NextCursor, l.models)
+	return count, err
+}
+
+// tenantKey 列表缓存的租户部分，非租户模型为空，跳过租户限制时为 *
+func (l *Logic) tenantKey() string {
+	if _, ok := l.svc.Model.(tenantAware); !ok {
+		return ""
+	}
+	tenantID, ignore := TenantFromContext(l.ctx)
+	if ignore {
+		return "*"
+	}
+	return "tenant:" + tenantID
+}
+
+// modelID 当前模型的ID
+func (l *Logic) modelID() string {
+	return utils.ToStr(reflect.ValueOf(l.svc.Model).Elem().FieldByName("ID").Interface())
+}
+
+// invalidateCache 数据变更后删除详情缓存并使列表缓存失效，在外层事务中时等事务提交后执行，
+// 避免提交前被并发读取重新缓存旧数据
+func (l *Logic) invalidateCache(ids ...string) {
+	if _, ok := l.cacheConfig(); !ok {
+		return
+	}
+	afterDatabaseCommit(l.opContext(), databaseName(l.svc.Model), func() {
+		l.clearCache(ids...)
+	})
+}
+
+// clearCache 删除详情缓存并递增列表缓存版本号
+func (l *Logic) clearCache(ids ...string) {
+	conn := redisConn()
+	defer conn.Close()
+	args := []interface{}{}
+	for _, id := range ids {
+		args = append(args, detailKey(l.svc.Model, id))
+	}
+	if len(args) > 0 {
+		if _, err := conn.Do("DEL", args...); err != nil {
+			fmt.Println("cache del err:", err)
+		}
+	}
+	if _, err := conn.Do("INCR", versionKey(l.svc.Model)); err != nil {
+		fmt.Println("cache incr err:", err)
+	}
+}
@@ -0,0 +1,199 @@
+package curd
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout 操作的默认超时时间，为 0 时只随请求取消
+var DefaultTimeout time.Duration
+
+// ContextAPI 支持上下文的通用服务，实现后 Logic 优先调用，请求断开或超时时中断查询
+type ContextAPI interface {
+	ListContext(ctx context.Context, search *Search, isHook bool, model interface{}) (int64, error)
+	AllContext(ctx context.Context, search *Search, isHook bool, model interface{}) error
+	DetailContext(ctx context.Context, model interface{}) error
+	AddContext(ctx context.Context, model interface{}) error
+	EditContext(ctx context.Context, model interface{}) error
+	DeleteContext(ctx context.Context, model interface{}) error
+}
+
+// Timeouter 模型自定义各接口的超时时间，返回 0 时使用 DefaultTimeout
+type Timeouter interface {
+	Timeout(endpoint Endpoint) time.Duration
+}
+
+// ctxSetter 设置模型查询使用的上下文，Model 和 ModelIdInt 实现
+type ctxSetter interface {
+	setContext(ctx context.Context)
+}
+
+// setContext 设置上下文
+func (m *Model) setContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// setContext 设置上下文
+func (m *ModelIdInt) setContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// ListContext 通用分页列表查询
+func (m *Model) ListContext(ctx context.Context, search *Search, isHook bool, model interface{}) (int64, error) {
+	return m.WithContext(ctx).List(search, isHook, model)
+}
+
+// AllContext 通用全部列表查询
+func (m *Model) AllContext(ctx context.Context, search *Search, isHook bool, model interface{}) error {
+	return m.WithContext(ctx).All(search, isHook, model)
+}
+
+// DetailContext 通用详情查询
+func (m *Model) DetailContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Detail(model)
+}
+
+// AddContext 通用新增
+func (m *Model) AddContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Add(model)
+}
+
+// EditContext 通用修改
+func (m *Model) EditContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Edit(model)
+}
+
+// DeleteContext 通用删除
+func (m *Model) DeleteContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Delete(model)
+}
+
+// ListContext 通用分页列表查询
+func (m *ModelIdInt) ListContext(ctx context.Context, search *Search, isHook bool, model interface{}) (int64, error) {
+	return m.WithContext(ctx).List(search, isHook, model)
+}
+
+// AllContext 通用全部列表查询
+func (m *ModelIdInt) AllContext(ctx context.Context, search *Search, isHook bool, model interface{}) error {
+	return m.WithContext(ctx).All(search, isHook, model)
+}
+
+// DetailContext 通用详情查询
+func (m *ModelIdInt) DetailContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Detail(model)
+}
+
+// AddContext 通用新增
+func (m *ModelIdInt) AddContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Add(model)
+}
+
+// EditContext 通用修改
+func (m *ModelIdInt) EditContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Edit(model)
+}
+
+// DeleteContext 通用删除
+func (m *ModelIdInt) DeleteContext(ctx context.Context, model interface{}) error {
+	return m.WithContext(ctx).Delete(model)
+}
+
+// opContext 当前操作的上下文，不在操作中时使用请求上下文，都没有时返回 nil
+func (l *Logic) opContext() context.Context {
+	if l.ctx != nil {
+		return l.ctx
+	}
+	if l.svc.Ctx != nil {
+		return l.svc.Ctx
+	}
+	return nil
+}
+
+// withContext 为一次操作设置请求上下文和超时，模型的查询随之取消，返回的函数结束操作并恢复之前的上下文
+func (l *Logic) withContext(endpoint Endpoint) func() {
+	parent := l.ctx
+	if parent == nil {
+		parent = context.Background()
+		if l.svc.Ctx != nil {
+			if l.svc.Ctx.Request != nil {
+				parent = l.svc.Ctx.Request.Context()
+			}
+			parent = tenantContext(parent, l.svc.Ctx)
+			if state := txStateFromContext(l.svc.Ctx); state != nil {
+				parent = context.WithValue(parent, txKey{}, state)
+			}
+		}
+	}
+	timeout := DefaultTimeout
+	if timeouter, ok := l.svc.Model.(Timeouter); ok {
+		if d := timeouter.Timeout(endpoint); d > 0 {
+			timeout = d
+		}
+	}
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+
+	prev := l.ctx
+	l.ctx = ctx
+	setter, ok := l.svc.Model.(ctxSetter)
+	if ok {
+		setter.setContext(ctx)
+	}
+	return func() {
+		cancel()
+		l.ctx = prev
+		if ok {
+			setter.setContext(prev)
+		}
+	}
+}
+
+// apiList 分页列表查询，实现了 ContextAPI 时传入上下文
+func (l *Logic) apiList(search *Search, isHook bool, models interface{}) (int64, error) {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.ListContext(l.ctx, search, isHook, models)
+	}
+	return l.svc.API.List(search, isHook, models)
+}
+
+// apiAll 全部列表查询
+func (l *Logic) apiAll(search *Search, isHook bool, models interface{}) error {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.AllContext(l.ctx, search, isHook, models)
+	}
+	return l.svc.API.All(search, isHook, models)
+}
+
+// apiDetail 详情查询
+func (l *Logic) apiDetail(model interface{}) error {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.DetailContext(l.ctx, model)
+	}
+	return l.svc.API.Detail(model)
+}
+
+// apiAdd 新增
+func (l *Logic) apiAdd(model interface{}) error {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.AddContext(l.ctx, model)
+	}
+	return l.svc.API.Add(model)
+}
+
+// apiEdit 修改
+func (l *Logic) apiEdit(model interface{}) error {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.EditContext(l.ctx, model)
+	}
+	return l.svc.API.Edit(model)
+}
+
+// apiDelete 删除
+func (l *Logic) apiDelete(model interface{}) error {
+	if api, ok := l.svc.API.(ContextAPI); ok && l.ctx != nil {
+		return api.DeleteContext(l.ctx, model)
+	}
+	return l.svc.API.Delete(model)
+}
@@ -0,0 +1,143 @@
+package curd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// CountExact 精确统计总数
+	CountExact = ""
+	// CountNone 不统计总数
+	CountNone = "none"
+	// CountEstimate 估算总数
+	CountEstimate = "estimate"
+)
+
+// cursor 游标分页位置，由排序字段值和ID组成
+type cursor struct {
+	Value interface{} `json:"v"`
+	ID    interface{} `json:"id"`
+}
+
+// encodeCursor 游标编码为不透明字符串
+func encodeCursor(c cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor 解析游标字符串
+func decodeCursor(str string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return c, errors.New("游标参数错误")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&c); err != nil {
+		return c, errors.New("游标参数错误")
+	}
+	return c, nil
+}
+
+// countQuery 按统计模式获取总数
+func countQuery(db *gorm.DB, search *Search, model interface{}) (int64, error) {
+	var count int64
+	switch search.CountMode {
+	case CountNone:
+		return 0, nil
+	case CountEstimate:
+		// 无过滤条件时读取表统计信息估算，有条件时退回精确统计
+		if !hasConditions(db) {
+			if err := db.Statement.Parse(model); err != nil {
+				return count, err
+			}
+			err := db.Session(&gorm.Session{NewDB: true}).
+				Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", db.Statement.Table).
+				Scan(&count).Error
+			return count, err
+		}
+	}
+	result := db.Count(&count)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return count, result.Error
+	}
+	return count, nil
+}
+
+// hasConditions 查询是否有过滤条件，试生成统计语句，包含数据范围、租户和软删除等执行时才附加的条件
+func hasConditions(db *gorm.DB) bool {
+	var count int64
+	tx := db.Session(&gorm.Session{DryRun: true}).Count(&count)
+	_, ok := tx.Statement.Clauses["WHERE"]
+	return ok || tx.Error != nil
+}
+
+// cursorQuery 游标分页查询，按排序字段和ID定位，不使用 OFFSET
+func cursorQuery(db *gorm.DB, search *Search, model interface{}, isHook bool) (int64, error) {
+	count, err := countQuery(db, search, model)
+	if err != nil {
+		return count, err
+	}
+	if err = db.Statement.Parse(model); err != nil {
+		return count, err
+	}
+	sortField := db.Statement.Schema.LookUpField(search.SortField)
+	idField := db.Statement.Schema.PrioritizedPrimaryField
+	if sortField == nil || idField == nil {
+		return count, errors.New("排序字段不支持游标分页")
+	}
+	op := "<"
+	if search.SortOrder == "asc" {
+		op = ">"
+	}
+	if search.Cursor != "" {
+		c, err := decodeCursor(search.Cursor)
+		if err != nil {
+			return count, err
+		}
+		if sortField == idField {
+			db = db.Where(fmt.Sprintf("%s %s ?", idField.DBName, op), c.ID)
+		} else {
+			db = db.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND %s %s ?)",
+				sortField.DBName, op, sortField.DBName, idField.DBName, op), c.Value, c.Value, c.ID)
+		}
+	}
+	db = db.Order(sortField.DBName + " " + search.SortOrder)
+	if sortField != idField {
+		db = db.Order(idField.DBName + " " + search.SortOrder)
+	}
+	db = preloadIncludes(db.Limit(search.PageSize), search)
+
+	var result *gorm.DB
+	if isHook {
+		result = db.Find(model)
+	} else {
+		result = db.Session(&gorm.Session{SkipHooks: true}).Find(model)
+	}
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return count, result.Error
+	}
+
+	// 本页不足一页时没有下一页
+	search.NextCursor = ""
+	rows := reflect.Indirect(reflect.ValueOf(model))
+	if rows.Kind() != reflect.Slice || rows.Len() < search.PageSize {
+		return count, nil
+	}
+	last := reflect.Indirect(rows.Index(rows.Len() - 1))
+	value, _ := sortField.ValueOf(db.Statement.Context, last)
+	id, _ := idField.ValueOf(db.Statement.Context, last)
+	search.NextCursor, err = encodeCursor(cursor{Value: value, ID: id})
+	return count, err
+}
@@ -0,0 +1,102 @@
+package curd
+
+import (
+	"reflect"
+
+	"github.com/lijianjunljj/gocommon/db"
+	"gorm.io/gorm"
+)
+
+// DatabaseModel 模型绑定的数据库，返回 db.Register 注册的名称，未实现或返回空时使用默认数据库
+type DatabaseModel interface {
+	Database() string
+}
+
+// dbSetter 设置模型使用的数据库名和连接，Model 和 ModelIdInt 实现
+type dbSetter interface {
+	setDB(name string, conn func() *gorm.DB)
+}
+
+// setDB 设置数据库名和连接
+func (m *Model) setDB(name string, conn func() *gorm.DB) {
+	m.database = name
+	m.mysql = conn
+}
+
+// setDB 设置数据库名和连接
+func (m *ModelIdInt) setDB(name string, conn func() *gorm.DB) {
+	m.database = name
+	m.mysql = conn
+}
+
+// databaseName 模型绑定的数据库名，model 可以是模型切片
+func databaseName(model interface{}) string {
+	if model == nil {
+		return db.DefaultName
+	}
+	rt := reflect.TypeOf(model)
+	for rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice {
+		rt = rt.Elem()
+	}
+	if named, ok := reflect.New(rt).Interface().(DatabaseModel); ok {
+		if name := named.Database(); name != "" {
+			return name
+		}
+	}
+	return db.DefaultName
+}
+
+// connDatabase WithMysql 设置的连接，适配为 db.AbstractDatabase
+type connDatabase func() *gorm.DB
+
+// DB 数据库连接
+func (c connDatabase) DB() *gorm.DB {
+	return c()
+}
+
+// Connect 连接由 WithMysql 的调用方管理，直接返回连接
+func (c connDatabase) Connect() *gorm.DB {
+	return c()
+}
+
+// AutoMigrate 同步表结构
+func (c connDatabase) AutoMigrate(dst ...interface{}) {
+	c().Set("gorm:table_options", "ENGINE=InnoDB").AutoMigrate(dst...)
+}
+
+// lookupDatabase 按名称获取数据库，为空时使用默认数据库；默认数据库优先使用 Init 或 WithMysql 设置的连接，
+// 未设置时使用 db.Register 注册的默认数据库，都没有时返回 nil。读写、事务、迁移统一通过这里选择数据库
+func lookupDatabase(name string) db.AbstractDatabase {
+	if name == "" {
+		name = db.DefaultName
+	}
+	if name == db.DefaultName && mysql != nil {
+		if mysqlFromInit {
+			return GetInstance()
+		}
+		return connDatabase(mysql)
+	}
+	return db.Get(name)
+}
+
+// lookupDB 按名称获取数据库连接，规则同 lookupDatabase，都没有时返回 nil
+func lookupDB(name string) *gorm.DB {
+	if database := lookupDatabase(name); database != nil {
+		return database.DB()
+	}
+	return nil
+}
+
+// databaseDB 按名称获取数据库连接，未注册时 panic
+func databaseDB(name string) *gorm.DB {
+	conn := lookupDB(name)
+	if conn == nil {
+		panic("curd: 数据库未注册：" + name)
+	}
+	return conn
+}
+
+// modelDB 模型绑定的数据库连接
+func modelDB(model interface{}) *gorm.DB {
+	return databaseDB(databaseName(model))
+}
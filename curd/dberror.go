@@ -0,0 +1,124 @@
+package curd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lijianjunljj/gocommon/db"
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+)
+
+// DBError 数据库约束错误的友好提示，带稳定的响应码，原始错误可通过 errors.Unwrap 获取
+type DBError struct {
+	Code  string
+	Field string
+	Msg   string
+	Err   error
+}
+
+func (e *DBError) Error() string {
+	return e.Msg
+}
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseCode 响应码
+func (e *DBError) ResponseCode() string {
+	return e.Code
+}
+
+// translateError 将数据库错误转换为带响应码的中文提示，字段使用模型的 json 字段名，其他错误原样返回
+func translateError(err error, model interface{}) error {
+	var classified *db.Error
+	if !errors.As(db.Classify(err), &classified) {
+		return err
+	}
+	field := dbFieldName(model, classified.Field)
+	e := &DBError{Field: field, Err: err}
+	switch classified.Kind {
+	case db.ErrDuplicate:
+		e.Code = utils.CodeDuplicate
+		e.Msg = "数据已存在"
+		if field != "" {
+			e.Msg = field + "已存在"
+			if classified.Value != "" {
+				e.Msg += "：" + classified.Value
+			}
+		}
+	case db.ErrForeignKey:
+		e.Code = utils.CodeReference
+		if classified.IsReferenced() {
+			e.Msg = "数据已被引用，无法删除"
+		} else {
+			e.Msg = "关联数据不存在"
+			if field != "" {
+				e.Msg += "：" + field
+			}
+		}
+	case db.ErrDataTooLong:
+		e.Code = utils.CodeTooLong
+		e.Msg = "数据超出长度限制"
+		if field != "" {
+			e.Msg = field + "超出长度限制"
+		}
+	case db.ErrDeadlock:
+		e.Code = utils.CodeRetry
+		e.Msg = "系统繁忙，请重试"
+	case db.ErrNotFound:
+		e.Code = utils.CodeNotFound
+		e.Msg = "数据不存在"
+	default:
+		return err
+	}
+	return e
+}
+
+// dbFieldName 列名或唯一索引名对应的 json 字段名，无法确定时返回原名
+func dbFieldName(model interface{}, name string) string {
+	if name == "" || model == nil {
+		return name
+	}
+	conn := lookupDB(databaseName(model))
+	if conn == nil {
+		return name
+	}
+	stmt := &gorm.Statement{DB: conn}
+	if err := stmt.Parse(model); err != nil {
+		return name
+	}
+	sch := stmt.Schema
+	fields := []string{}
+	if field := sch.LookUpField(name); field != nil {
+		fields = append(fields, jsonFieldName(field.Tag.Get("json"), field.DBName))
+	} else if name == "PRIMARY" {
+		for _, field := range sch.PrimaryFields {
+			fields = append(fields, jsonFieldName(field.Tag.Get("json"), field.DBName))
+		}
+	} else if index, ok := sch.ParseIndexes()[name]; ok {
+		for _, option := range index.Fields {
+			fields = append(fields, jsonFieldName(option.Tag.Get("json"), option.DBName))
+		}
+	}
+	if len(fields) == 0 {
+		return name
+	}
+	return strings.Join(fields, ",")
+}
+
+// jsonFieldName json 标签中的字段名，没有时使用列名
+func jsonFieldName(tag string, dbName string) string {
+	name := strings.Split(tag, ",")[0]
+	if name == "" || name == "-" {
+		return dbName
+	}
+	return name
+}
+
+// fail 响应错误，数据库约束错误转换为友好提示
+func (h *Handler) fail(ctx *gin.Context, err error) {
+	utils.Fail(ctx, translateError(err, h.model))
+}
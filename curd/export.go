@@ -0,0 +1,303 @@
+package curd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+
+	// exportSheet xlsx 导出的工作表名
+	exportSheet = "Sheet1"
+)
+
+// Formatter 导出列格式化函数
+type Formatter func(value interface{}) string
+
+var (
+	// timeLayouts 时间戳列的格式，导出格式化和导入解析共用
+	timeLayouts = map[string]string{
+		"datetime": "2006-01-02 15:04:05",
+		"date":     "2006-01-02",
+	}
+	formatters = map[string]Formatter{
+		"datetime": unixFormatter(timeLayouts["datetime"]),
+		"date":     unixFormatter(timeLayouts["date"]),
+	}
+	formattersMu sync.RWMutex
+)
+
+// RegisterFormatter 注册导出格式化函数，可在 export 标签中以 format=名称 使用
+func RegisterFormatter(name string, formatter Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[name] = formatter
+}
+
+// unixFormatter 时间戳格式化为时间字符串，0 输出为空
+func unixFormatter(layout string) Formatter {
+	return func(value interface{}) string {
+		rv := reflect.ValueOf(value)
+		var unix int64
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			unix = rv.Int()
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			unix = int64(rv.Uint())
+		default:
+			return formatValue(value)
+		}
+		if unix == 0 {
+			return ""
+		}
+		// 毫秒时间戳
+		if unix > 1e12 {
+			return time.UnixMilli(unix).Format(layout)
+		}
+		return time.Unix(unix, 0).Format(layout)
+	}
+}
+
+// ExportConfig 导出配置
+type ExportConfig struct {
+	// Columns 默认导出列，json 字段名，为空时导出全部带 export 标签的列
+	Columns []string
+	// Formatters 列格式化，key 为 json 字段名
+	Formatters map[string]Formatter
+	// BatchSize 每批读取条数
+	BatchSize int
+}
+
+// ExportParams 导出入参，查询条件与列表一致
+type ExportParams struct {
+	Search
+	Format   string   `json:"format"`
+	Columns  []string `json:"columns"`
+	FileName string   `json:"fileName"`
+}
+
+// exportColumn 导出列
+type exportColumn struct {
+	name      string
+	header    string
+	index     []int
+	formatter Formatter
+}
+
+// exportColumns 解析模型的导出列，表头取 export 标签，如 `export:"创建时间,format=datetime"`
+func exportColumns(t reflect.Type, config *ExportConfig, selected []string) ([]exportColumn, error) {
+	var all []exportColumn
+	tagged := false
+	for _, field := range reflect.VisibleFields(t) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		column := exportColumn{name: name, header: name, index: field.Index}
+		if tag, ok := field.Tag.Lookup("export"); ok {
+			if !tagged {
+				tagged = true
+				all = all[:0]
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				column.header = parts[0]
+			}
+			for _, part := range parts[1:] {
+				if strings.HasPrefix(part, "format=") {
+					formattersMu.RLock()
+					column.formatter = formatters[strings.TrimPrefix(part, "format=")]
+					formattersMu.RUnlock()
+				}
+			}
+		} else if tagged {
+			continue
+		}
+		if formatter, ok := config.Formatters[name]; ok {
+			column.formatter = formatter
+		}
+		all = append(all, column)
+	}
+
+	if len(selected) == 0 {
+		selected = config.Columns
+	}
+	if len(selected) == 0 {
+		return all, nil
+	}
+	columns := make([]exportColumn, 0, len(selected))
+	for _, name := range selected {
+		found := false
+		for _, column := range all {
+			if column.name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("导出列不存在：" + name)
+		}
+	}
+	return columns, nil
+}
+
+// formatValue 默认格式化
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case json.Marshaler:
+		data, _ := v.MarshalJSON()
+		return strings.Trim(string(data), `"`)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Struct:
+		data, _ := json.Marshal(value)
+		return string(data)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return ""
+		}
+		return formatValue(rv.Elem().Interface())
+	}
+	return utils.ToStr(value)
+}
+
+// exportRow 一行导出数据
+func exportRow(row reflect.Value, columns []exportColumn) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value := row.FieldByIndex(column.index).Interface()
+		if column.formatter != nil {
+			values[i] = column.formatter(value)
+		} else {
+			values[i] = formatValue(value)
+		}
+		values[i] = escapeFormula(values[i])
+	}
+	return values
+}
+
+// escapeFormula 以 =、+、-、@、制表符或回车开头的单元格加单引号前缀，防止表格软件当作公式执行，数字不处理
+func escapeFormula(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
+
+// rowWriter 导出文件写入
+type rowWriter interface {
+	Write(row []string) error
+	Close() error
+}
+
+// csvWriter CSV 写入，带 BOM 便于 Excel 识别 UTF-8
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (c *csvWriter) Write(row []string) error {
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsxWriter XLSX 流式写入
+type xlsxWriter struct {
+	out  io.Writer
+	file *excelize.File
+	sw   *excelize.StreamWriter
+	row  int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	sw, err := file.NewStreamWriter(exportSheet)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxWriter{out: w, file: file, sw: sw}, nil
+}
+
+func (x *xlsxWriter) Write(row []string) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		values[i] = value
+	}
+	return x.sw.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
+
+// newRowWriter 按格式创建导出写入
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch format {
+	case "", ExportCSV:
+		return newCSVWriter(w)
+	case ExportXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, errors.New("不支持的导出格式：" + format)
+}
+
+// exportContentType 导出文件类型
+func exportContentType(format string) string {
+	if format == ExportXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// attachment 下载文件名，兼容中文
+func attachment(fileName string) string {
+	return "attachment; filename=\"" + url.PathEscape(fileName) + "\"; filename*=UTF-8''" + url.PathEscape(fileName)
+}
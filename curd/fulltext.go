@@ -0,0 +1,100 @@
+package curd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SortRelevance 按全文搜索相关度排序，Search.SortField 设置为该值且 Keyword 不为空时生效
+const SortRelevance = "relevance"
+
+// FullTextFields 模型的全文搜索字段，AutoMigrate 时创建 FULLTEXT 索引，Search.Keyword 在这些字段中搜索
+type FullTextFields interface {
+	FullTextFields() []string
+}
+
+// fullTextColumns 校验并返回全文搜索字段的列名
+func fullTextColumns(db *gorm.DB, model interface{}) ([]string, error) {
+	if err := db.Statement.Parse(model); err != nil {
+		return nil, err
+	}
+	fullText, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(FullTextFields)
+	if !ok {
+		return nil, errors.New("该模型不支持全文搜索")
+	}
+	var columns []string
+	for _, name := range fullText.FullTextFields() {
+		field := db.Statement.Schema.LookUpField(name)
+		if field == nil {
+			field = db.Statement.Schema.LookUpField(utils.CamelToLine(name))
+		}
+		if field == nil || field.DBName == "" {
+			return nil, errors.New("全文搜索字段不存在：" + name)
+		}
+		columns = append(columns, field.DBName)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("全文搜索字段不能为空")
+	}
+	return columns, nil
+}
+
+// keywordQuery 按 Search.Keyword 全文搜索，需要按相关度排序时同时设置排序，返回是否已排序
+func keywordQuery(db *gorm.DB, search *Search, model interface{}) (*gorm.DB, bool, error) {
+	if search.Keyword == "" {
+		return db, false, nil
+	}
+	columns, err := fullTextColumns(db, model)
+	if err != nil {
+		return db, false, err
+	}
+	match := clause.Expr{
+		SQL:  "MATCH(" + strings.Join(columns, ",") + ") AGAINST (? IN NATURAL LANGUAGE MODE)",
+		Vars: []interface{}{search.Keyword},
+	}
+	db = db.Where(match)
+	if search.SortField != SortRelevance {
+		return db, false, nil
+	}
+	if search.UseCursor {
+		return db, false, errors.New("相关度排序不支持游标分页")
+	}
+	return db.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: match.SQL + " DESC", Vars: match.Vars}}), true, nil
+}
+
+// fullTextIndexName 全文索引名
+func fullTextIndexName(table string) string {
+	return "ft_" + table
+}
+
+// MigrateFullText 为实现了 FullTextFields 的模型创建 FULLTEXT 索引，使用 ngram 分词支持中文。
+// 索引已存在时跳过，修改全文搜索字段后需先手动删除旧索引
+func MigrateFullText(db *gorm.DB, dst ...interface{}) error {
+	for _, model := range dst {
+		if _, ok := model.(FullTextFields); !ok {
+			continue
+		}
+		session := db.Session(&gorm.Session{NewDB: true})
+		columns, err := fullTextColumns(session, model)
+		if err != nil {
+			return err
+		}
+		table := session.Statement.Schema.Table
+		name := fullTextIndexName(table)
+		if db.Migrator().HasIndex(model, name) {
+			continue
+		}
+		err = db.Exec(fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s) WITH PARSER ngram",
+			name, table, strings.Join(columns, ","))).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,17 +1,25 @@
 package curd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/lijianjunljj/gocommon/utils"
+	"net/http"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Handler 操作层
 type Handler struct {
 	model  interface{}
 	models interface{}
+	hooks  []interface{}
 }
 
 // Pages 分页列表数据结构
@@ -21,6 +29,8 @@ type Pages struct {
 	PageSize int         `json:"pageSize"`
 	PageNum  int         `json:"pageNum"`
 	Extra    interface{} `json:"extra"`
+	// NextCursor 游标分页下一页游标，为空表示没有更多数据
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // NewHandler 实例化操作
@@ -35,42 +45,60 @@ func NewHandler(model interface{}, models ...interface{}) *Handler {
 	}
 }
 
+// WithHooks 注册模型之外的生命周期钩子，hooks 为实现了 BeforeAddHook 等接口的对象
+func (h *Handler) WithHooks(hooks ...interface{}) *Handler {
+	h.hooks = append(h.hooks, hooks...)
+	return h
+}
+
+// selfConditions 只查询自己的数据时追加 user_id 条件，由上下文 is_self 或查询参数 is_self 开启
+func selfConditions(ctx *gin.Context, conditions map[string]interface{}) (map[string]interface{}, error) {
+	isSelf := ctx.GetBool("is_self")
+	if !isSelf && ctx.Query("is_self") != "" {
+		var err error
+		isSelf, err = strconv.ParseBool(ctx.Query("is_self"))
+		if err != nil {
+			return conditions, err
+		}
+	}
+	if isSelf {
+		if conditions == nil {
+			conditions = make(map[string]interface{})
+		}
+		conditions["user_id"] = ctx.GetString("userID")
+	}
+	return conditions, nil
+}
+
 // List 分页列表
 func (h *Handler) List(ctx *gin.Context, isHook bool, extras ...Extra) {
 	var search Search
 	err := ctx.ShouldBindBodyWith(&search, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
-	is_self := ctx.Query("is_self")
-
-	if is_self != "" {
-		isSelf, err := strconv.ParseBool(is_self)
-		if err != nil {
-			utils.Fail(ctx, err)
-			return
-		}
-		if isSelf {
-			if search.Conditions == nil {
-				search.Conditions = make(map[string]interface{})
-			}
-			search.Conditions["user_id"] = ctx.GetString("userID")
-		}
+	search.Conditions, err = selfConditions(ctx, search.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc, h.models)
 	count, err := l.List(&search, isHook, extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 
 	utils.Success(ctx, Pages{
-		PageNum:  search.PageNum,
-		PageSize: search.PageSize,
-		Count:    count,
-		Data:     h.models,
+		PageNum:    search.PageNum,
+		PageSize:   search.PageSize,
+		Count:      count,
+		Data:       h.models,
+		NextCursor: search.NextCursor,
 	})
 }
 
@@ -79,18 +107,21 @@ func (h *Handler) All(ctx *gin.Context, extras ...Extra) {
 	var search Search
 	err := ctx.ShouldBindBodyWith(&search, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
-	isSelf := ctx.GetBool("is_self")
-	if isSelf {
-		search.Conditions["user_id"] = ctx.GetString("userID")
+	search.Conditions, err = selfConditions(ctx, search.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc, h.models)
 	err = l.All(&search, false, extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 	utils.Success(ctx, h.models)
@@ -101,26 +132,30 @@ func (h *Handler) ListWithHook(ctx *gin.Context, extras ...Extra) {
 	var search Search
 	err := ctx.ShouldBindBodyWith(&search, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
-	isSelf := ctx.GetBool("is_self")
-	if isSelf {
-		search.Conditions["user_id"] = ctx.GetString("userID")
+	search.Conditions, err = selfConditions(ctx, search.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc, h.models)
 	count, err := l.List(&search, true, extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 
 	utils.Success(ctx, Pages{
-		PageNum:  search.PageNum,
-		PageSize: search.PageSize,
-		Count:    count,
-		Data:     h.models,
+		PageNum:    search.PageNum,
+		PageSize:   search.PageSize,
+		Count:      count,
+		Data:       h.models,
+		NextCursor: search.NextCursor,
 	})
 }
 
@@ -129,32 +164,54 @@ func (h *Handler) AllWithHook(ctx *gin.Context, extras ...Extra) {
 	var search Search
 	err := ctx.ShouldBindBodyWith(&search, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+	search.Conditions, err = selfConditions(ctx, search.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc, h.models)
 	err = l.All(&search, true, extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 	utils.Success(ctx, h.models)
 }
 
+// Add 新增，请求头带 Idempotency-Key 时重复请求返回首次的响应
 func (h *Handler) Add(ctx *gin.Context, extras ...Extra) {
+	withIdempotency(ctx, func() {
+		h.add(ctx, extras...)
+	})
+}
+
+// add 新增
+func (h *Handler) add(ctx *gin.Context, extras ...Extra) {
 	err := ctx.ShouldBindBodyWith(h.model, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+	err = utils.ValidateGroup(h.model, utils.ValidateCreate)
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc)
 	userID, _ := ctx.Get("userID")
 
 	err = l.Add(userID.(string), extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 	utils.Success(ctx, h.model)
@@ -164,24 +221,77 @@ func (h *Handler) Add(ctx *gin.Context, extras ...Extra) {
 func (h *Handler) Edit(ctx *gin.Context, extras ...Extra) {
 	err := ctx.ShouldBindBodyWith(h.model, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+	err = requireVersion(ctx, h.model)
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc)
-	err = l.Detail()
+	err = l.detail()
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 	err = ctx.ShouldBindBodyWith(h.model, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+	// 合并已有数据后校验，未提交的字段使用原值
+	err = utils.ValidateGroup(h.model, utils.ValidateUpdate)
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 	err = l.Edit(extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, h.model)
+}
+
+// Patch 局部更新，只更新请求体中出现的字段，零值也会被更新
+func (h *Handler) Patch(ctx *gin.Context, extras ...Extra) {
+	fields := make(map[string]json.RawMessage)
+	err := ctx.ShouldBindBodyWith(&fields, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	err = ctx.ShouldBindBodyWith(h.model, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	// 只校验提交的字段，未提交的字段不更新
+	err = utils.ValidatePartial(h.model, utils.ValidateUpdate, keys)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	err = l.Patch(keys, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	err = l.detail()
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 	utils.Success(ctx, h.model)
@@ -191,14 +301,16 @@ func (h *Handler) Edit(ctx *gin.Context, extras ...Extra) {
 func (h *Handler) Detail(ctx *gin.Context, extras ...Extra) {
 	err := ctx.ShouldBindBodyWith(&h.model, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc)
 	err = l.Detail(extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
 
@@ -210,17 +322,369 @@ func (h *Handler) Delete(ctx *gin.Context, extras ...Extra) {
 	params := make(map[string]interface{})
 	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
 		return
 	}
-	fmt.Println("params[\"id\"]:",params["id"])
+	fmt.Println("params[\"id\"]:", params["id"])
 	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
 	l := NewLogic(svc)
 	err = l.Delete(fmt.Sprintf("%v", params["id"]), extras...)
 	if err != nil {
-		utils.Fail(ctx, err)
+		h.fail(ctx, err)
+		return
+	}
+
+	utils.Success(ctx, h.model)
+}
+
+// Trash 回收站列表
+func (h *Handler) Trash(ctx *gin.Context, extras ...Extra) {
+	var search Search
+	err := ctx.ShouldBindBodyWith(&search, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	search.Conditions, err = selfConditions(ctx, search.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc, h.models)
+	count, err := l.Trash(&search, false, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+
+	utils.Success(ctx, Pages{
+		PageNum:    search.PageNum,
+		PageSize:   search.PageSize,
+		Count:      count,
+		Data:       h.models,
+		NextCursor: search.NextCursor,
+	})
+}
+
+// Restore 恢复软删除的记录
+func (h *Handler) Restore(ctx *gin.Context, extras ...Extra) {
+	params := make(map[string]interface{})
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	err = l.Restore(fmt.Sprintf("%v", params["id"]), extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+
+	utils.Success(ctx, h.model)
+}
+
+// Purge 彻底删除回收站中的记录
+func (h *Handler) Purge(ctx *gin.Context, extras ...Extra) {
+	params := make(map[string]interface{})
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	err = l.Purge(fmt.Sprintf("%v", params["id"]), extras...)
+	if err != nil {
+		h.fail(ctx, err)
 		return
 	}
 
 	utils.Success(ctx, h.model)
 }
+
+// BatchAdd 批量新增
+func (h *Handler) BatchAdd(ctx *gin.Context, extras ...Extra) {
+	var params BatchParams
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	err = json.Unmarshal(params.Items, h.models)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	err = validateItems(h.models, utils.ValidateCreate, nil)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc, h.models)
+	results, err := l.BatchAdd(ctx.GetString("userID"), params.Partial, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, results)
+}
+
+// BatchEdit 批量编辑
+func (h *Handler) BatchEdit(ctx *gin.Context, extras ...Extra) {
+	var params BatchParams
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	err = json.Unmarshal(params.Items, h.models)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	// 批量编辑只更新非零值字段，每条只校验提交的字段
+	var items []map[string]json.RawMessage
+	err = json.Unmarshal(params.Items, &items)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	fields := make([][]string, len(items))
+	for i, item := range items {
+		for key := range item {
+			fields[i] = append(fields[i], key)
+		}
+	}
+	err = validateItems(h.models, utils.ValidateUpdate, fields)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc, h.models)
+	results, err := l.BatchEdit(params.Partial, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, results)
+}
+
+// BatchDelete 批量删除
+func (h *Handler) BatchDelete(ctx *gin.Context, extras ...Extra) {
+	var params BatchParams
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	count, err := l.BatchDelete(params.IDs, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, map[string]interface{}{"count": count})
+}
+
+// History 单条记录的变更历史
+func (h *Handler) History(ctx *gin.Context) {
+	params := make(map[string]interface{})
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	logs, err := l.History(utils.ToStr(params["id"]))
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, logs)
+}
+
+// Export 导出列表为 CSV 或 XLSX，查询条件与 All 一致，分批读取写入
+func (h *Handler) Export(ctx *gin.Context, configs ...ExportConfig) {
+	var params ExportParams
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	params.Conditions, err = selfConditions(ctx, params.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	var config ExportConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = BatchSize
+	}
+	rowType, err := rowTypeOf(h.models)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	columns, err := exportColumns(rowType, &config, params.Columns)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	if params.Format != "" && params.Format != ExportCSV && params.Format != ExportXLSX {
+		h.fail(ctx, errors.New("不支持的导出格式："+params.Format))
+		return
+	}
+	if params.Format == "" {
+		params.Format = ExportCSV
+	}
+	if params.FileName == "" {
+		params.FileName = modelName(h.models) + "_" + time.Now().Format("20060102150405")
+	}
+
+	// 第一批数据查询成功后才写响应头，排序字段、游标等参数错误时仍可返回错误响应
+	var writer rowWriter
+	start := func() error {
+		ctx.Header("Content-Type", exportContentType(params.Format))
+		ctx.Header("Content-Disposition", attachment(params.FileName+"."+params.Format))
+		ctx.Status(http.StatusOK)
+		var err error
+		writer, err = newRowWriter(params.Format, ctx.Writer)
+		if err != nil {
+			return err
+		}
+		headers := make([]string, len(columns))
+		for i, column := range columns {
+			headers[i] = column.header
+		}
+		return writer.Write(headers)
+	}
+
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc, h.models)
+	err = l.Export(&params.Search, config.BatchSize, func(models interface{}) error {
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		rows := reflect.ValueOf(models).Elem()
+		for i := 0; i < rows.Len(); i++ {
+			if err := writer.Write(exportRow(reflect.Indirect(rows.Index(i)), columns)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && writer == nil {
+		h.fail(ctx, err)
+		return
+	}
+	if err != nil {
+		ctx.Error(err)
+	}
+	// 没有数据时只导出表头
+	if writer == nil {
+		if err = start(); err != nil {
+			ctx.Error(err)
+			return
+		}
+	}
+	if err = writer.Close(); err != nil {
+		ctx.Error(err)
+	}
+}
+
+// Import 导入 CSV 或 XLSX 文件，表单字段 file 为文件，dryRun 为 true 时只校验不写入
+func (h *Handler) Import(ctx *gin.Context, extras ...Extra) {
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		h.fail(ctx, errors.New("请上传导入文件"))
+		return
+	}
+	format := ctx.PostForm("format")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	}
+	dryRun, _ := strconv.ParseBool(ctx.PostForm("dryRun"))
+	f, err := file.Open()
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	defer f.Close()
+	records, err := readImportRows(format, f)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc, h.models)
+	result, err := l.Import(ctx.GetString("userID"), records, dryRun, extras...)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	utils.Success(ctx, result)
+}
+
+// Aggregate 分组统计，如按状态、按天统计订单数量和金额
+func (h *Handler) Aggregate(ctx *gin.Context, extras ...Extra) {
+	var params AggregateParams
+	err := ctx.ShouldBindBodyWith(&params, binding.JSON)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	params.Conditions, err = selfConditions(ctx, params.Conditions)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	svc := NewService(h.model)
+	svc.Ctx = ctx
+	svc.Hooks = h.hooks
+	l := NewLogic(svc)
+	rows, err := l.Aggregate(&params)
+	if err != nil {
+		h.fail(ctx, err)
+		return
+	}
+	for _, extra := range extras {
+		err = extra(rows)
+		if err != nil {
+			h.fail(ctx, err)
+			return
+		}
+	}
+	utils.Success(ctx, rows)
+}
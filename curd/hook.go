@@ -0,0 +1,269 @@
+package curd
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HookContext 钩子上下文，Tx 为本次操作的事务，钩子返回错误时事务回滚
+type HookContext struct {
+	Ctx    *gin.Context
+	UserID string
+	Tx     *gorm.DB
+	// Model 当前操作的模型，AfterList 时为列表
+	Model interface{}
+}
+
+// 生命周期钩子，可由模型实现，也可通过 Handler.WithHooks 或 WithHooks 注册任意实现了钩子的对象。
+// 注意 BeforeDelete、AfterDelete 与 gorm 的同名钩子签名不同，模型实现其中一个后不能再实现另一个。
+
+// BeforeAddHook 新增前
+type BeforeAddHook interface {
+	BeforeAdd(hc *HookContext) error
+}
+
+// AfterAddHook 新增后，与新增在同一事务中
+type AfterAddHook interface {
+	AfterAdd(hc *HookContext) error
+}
+
+// BeforeEditHook 修改前，Edit 和 Patch 均会执行
+type BeforeEditHook interface {
+	BeforeEdit(hc *HookContext) error
+}
+
+// AfterEditHook 修改后，与修改在同一事务中
+type AfterEditHook interface {
+	AfterEdit(hc *HookContext) error
+}
+
+// BeforeDeleteHook 删除前，批量ID时每条执行一次
+type BeforeDeleteHook interface {
+	BeforeDelete(hc *HookContext) error
+}
+
+// AfterDeleteHook 删除后，与删除在同一事务中
+type AfterDeleteHook interface {
+	AfterDelete(hc *HookContext) error
+}
+
+// AfterDetailHook 详情查询后
+type AfterDetailHook interface {
+	AfterDetail(hc *HookContext) error
+}
+
+// AfterListHook 列表查询后，List 和 All 均会执行
+type AfterListHook interface {
+	AfterList(hc *HookContext) error
+}
+
+// txSetter 设置模型写操作使用的事务，Model 和 ModelIdInt 实现
+type txSetter interface {
+	setTx(tx *gorm.DB)
+}
+
+// setTx 设置事务
+func (m *Model) setTx(tx *gorm.DB) {
+	m.tx = tx
+}
+
+// setTx 设置事务
+func (m *ModelIdInt) setTx(tx *gorm.DB) {
+	m.tx = tx
+}
+
+// conn 数据库连接，在事务中时使用事务，未绑定数据库时使用默认数据库，设置了上下文时随上下文取消
+func (m *Model) conn() *gorm.DB {
+	db := m.tx
+	if db == nil && m.mysql != nil {
+		db = m.mysql()
+	} else if db == nil {
+		db = databaseDB("")
+	}
+	if m.ctx != nil {
+		db = db.WithContext(m.ctx)
+	}
+	return db
+}
+
+// hookTargets 钩子的实现对象，先执行模型的钩子，再执行注册的钩子
+func (l *Logic) hookTargets() []interface{} {
+	return append([]interface{}{l.svc.Model}, l.svc.Hooks...)
+}
+
+// runHooks 依次执行钩子，遇到错误立即返回
+func (l *Logic) runHooks(call func(target interface{}) error) error {
+	for _, target := range l.hookTargets() {
+		if err := call(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowHook 对批量操作的单条数据执行钩子，先执行数据本身的钩子，再执行注册的钩子
+func (l *Logic) rowHook(tx *gorm.DB, row interface{}, userID string, call func(hc *HookContext, target interface{}) error) error {
+	hc := &HookContext{Ctx: l.svc.Ctx, UserID: userID, Tx: tx, Model: row}
+	for _, target := range append([]interface{}{row}, l.svc.Hooks...) {
+		if err := call(hc, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowHooks 对批量操作的每条数据执行钩子，遇到错误立即返回
+func (l *Logic) rowHooks(tx *gorm.DB, rows reflect.Value, userID string, call func(hc *HookContext, target interface{}) error) error {
+	for i := 0; i < rows.Len(); i++ {
+		if err := l.rowHook(tx, rowAt(rows, i).Interface(), userID, call); err != nil {
+			return fmt.Errorf("第%d条数据：%s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
+// beforeAdd 执行新增前钩子
+func beforeAdd(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(BeforeAddHook); ok {
+		return hook.BeforeAdd(hc)
+	}
+	return nil
+}
+
+// afterAdd 执行新增后钩子
+func afterAdd(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(AfterAddHook); ok {
+		return hook.AfterAdd(hc)
+	}
+	return nil
+}
+
+// beforeEdit 执行修改前钩子
+func beforeEdit(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(BeforeEditHook); ok {
+		return hook.BeforeEdit(hc)
+	}
+	return nil
+}
+
+// afterEdit 执行修改后钩子
+func afterEdit(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(AfterEditHook); ok {
+		return hook.AfterEdit(hc)
+	}
+	return nil
+}
+
+// beforeDelete 执行删除前钩子
+func beforeDelete(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(BeforeDeleteHook); ok {
+		return hook.BeforeDelete(hc)
+	}
+	return nil
+}
+
+// afterDelete 执行删除后钩子
+func afterDelete(hc *HookContext, target interface{}) error {
+	if hook, ok := target.(AfterDeleteHook); ok {
+		return hook.AfterDelete(hc)
+	}
+	return nil
+}
+
+// hasHooks 是否实现了任一写操作钩子，有钩子时写操作在事务中执行
+func (l *Logic) hasHooks(check func(target interface{}) bool) bool {
+	for _, target := range l.hookTargets() {
+		if check(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// inTx 有钩子时在事务中执行写操作，fn 返回错误或 panic 时回滚，请求上下文中已有事务时使用保存点
+func (l *Logic) inTx(useTx bool, fn func(tx *gorm.DB) error) error {
+	setter, ok := l.svc.Model.(txSetter)
+	if !useTx || !ok {
+		return fn(l.ambientTx())
+	}
+	txn := l.txn()
+	setter.setTx(txn.Tx)
+	defer func() {
+		setter.setTx(l.ambientTx())
+		if r := recover(); r != nil {
+			txn.TryRollback()
+			panic(r)
+		}
+	}()
+	if err := fn(txn.Tx); err != nil {
+		txn.TryRollback()
+		return err
+	}
+	return txn.TryCommit()
+}
+
+// ambientTx 请求上下文中模型所在数据库的事务，没有时返回 nil
+func (l *Logic) ambientTx() *gorm.DB {
+	if l.svc.Ctx == nil {
+		return nil
+	}
+	return DatabaseTxFromContext(l.svc.Ctx, databaseName(l.svc.Model))
+}
+
+// txn 开启写操作事务，请求上下文中已有事务时加入该事务，事务中的语句使用当前操作的上下文
+func (l *Logic) txn() *Txn {
+	var txn *Txn
+	if l.svc.Ctx != nil {
+		txn = contextTxn(l.svc.Ctx, l.svc.Model)
+	} else {
+		txn = NewModelTxn(l.svc.Model)
+	}
+	if l.ctx != nil {
+		txn.Tx = txn.Tx.WithContext(l.ctx)
+	}
+	return txn
+}
+
+// edit 执行修改前后的钩子，有钩子或 useTx 为 true 时修改在事务中执行
+func (l *Logic) edit(useTx bool, update func(tx *gorm.DB) error) error {
+	hooked := l.hasHooks(func(target interface{}) bool {
+		_, before := target.(BeforeEditHook)
+		_, after := target.(AfterEditHook)
+		return before || after
+	})
+	return l.inTx(hooked || useTx, func(tx *gorm.DB) error {
+		hc := &HookContext{Ctx: l.svc.Ctx, UserID: l.userID(), Tx: tx, Model: l.svc.Model}
+		err := l.runHooks(func(target interface{}) error {
+			if hook, ok := target.(BeforeEditHook); ok {
+				return hook.BeforeEdit(hc)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = update(tx); err != nil {
+			return err
+		}
+		return l.runHooks(func(target interface{}) error {
+			if hook, ok := target.(AfterEditHook); ok {
+				return hook.AfterEdit(hc)
+			}
+			return nil
+		})
+	})
+}
+
+// afterList 执行列表查询后的钩子
+func (l *Logic) afterList() error {
+	hc := &HookContext{Ctx: l.svc.Ctx, UserID: l.userID(), Model: l.models}
+	return l.runHooks(func(target interface{}) error {
+		if hook, ok := target.(AfterListHook); ok {
+			return hook.AfterList(hc)
+		}
+		return nil
+	})
+}
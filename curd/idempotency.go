@@ -0,0 +1,213 @@
+package curd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/lijianjunljj/gocommon/utils"
+)
+
+var (
+	// IdempotencyHeader 幂等键请求头
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotencyTTL 首次响应的保存时间
+	IdempotencyTTL = 24 * time.Hour
+	// IdempotencyLockTTL 请求处理中的锁定时间，超时后允许重试
+	IdempotencyLockTTL = time.Minute
+)
+
+// idempotencyHandled 上下文中标记已由中间件处理，Handler.Add 不再重复处理
+const idempotencyHandled = "curd.idempotency"
+
+// idempotencyRecord 幂等键记录，Done 为 false 表示请求处理中
+type idempotencyRecord struct {
+	Hash        string `json:"hash"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// idempotencyWriter 记录响应内容
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 幂等中间件，用于新增以外的 POST 接口，如 WithMiddleware(EndpointBatchAdd, Idempotency())。
+// 请求头带 Idempotency-Key 时，成功的响应保存到 Redis 并在重复请求时原样返回，
+// 处理中的重复请求和同一个键用于不同请求体时返回错误，失败的响应不保存，允许重试
+func Idempotency() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		withIdempotency(ctx, ctx.Next)
+	}
+}
+
+// withIdempotency 按幂等键执行 next，未设置 Redis 或请求头为空时直接执行
+func withIdempotency(ctx *gin.Context, next func()) {
+	idempotencyKey := ctx.GetHeader(IdempotencyHeader)
+	if idempotencyKey == "" || redisConn == nil || ctx.GetBool(idempotencyHandled) {
+		next()
+		return
+	}
+	ctx.Set(idempotencyHandled, true)
+
+	body, err := requestBody(ctx)
+	if err != nil {
+		utils.Fail(ctx, err)
+		ctx.Abort()
+		return
+	}
+	hash := sha1.Sum([]byte(ctx.Request.Method + " " + ctx.Request.URL.Path + "\n" + string(body)))
+	// 幂等键按用户隔离，不同用户使用相同的键互不影响
+	key := CachePrefix + "idempotency:" + ctx.GetString("userID") + ":" + idempotencyKey
+	record := idempotencyRecord{Hash: hex.EncodeToString(hash[:])}
+
+	acquired, existing, err := acquireIdempotency(key, record)
+	if err != nil {
+		utils.Fail(ctx, err)
+		ctx.Abort()
+		return
+	}
+	if !acquired {
+		replayIdempotency(ctx, record.Hash, existing)
+		return
+	}
+
+	writer := &idempotencyWriter{ResponseWriter: ctx.Writer}
+	ctx.Writer = writer
+	defer func() {
+		ctx.Writer = writer.ResponseWriter
+		if r := recover(); r != nil {
+			releaseIdempotency(key)
+			panic(r)
+		}
+		if !idempotencySucceeded(writer.Status(), writer.body.Bytes()) {
+			releaseIdempotency(key)
+			return
+		}
+		record.Done = true
+		record.Status = writer.Status()
+		record.ContentType = writer.Header().Get("Content-Type")
+		record.Body = writer.body.Bytes()
+		if err := setIdempotency(key, record, IdempotencyTTL); err != nil {
+			fmt.Println("idempotency set err:", err)
+		}
+	}()
+	next()
+}
+
+// requestBody 读取请求体并缓存，后续 ShouldBindBodyWith 直接使用
+func requestBody(ctx *gin.Context) ([]byte, error) {
+	if cached, ok := ctx.Get(gin.BodyBytesKey); ok {
+		if body, ok := cached.([]byte); ok {
+			return body, nil
+		}
+	}
+	if ctx.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	ctx.Set(gin.BodyBytesKey, body)
+	return body, nil
+}
+
+// acquireIdempotency 占用幂等键，已存在时返回已有记录
+func acquireIdempotency(key string, record idempotencyRecord) (bool, *idempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, nil, err
+	}
+	conn := redisConn()
+	defer conn.Close()
+	_, err = redis.String(conn.Do("SET", key, data, "NX", "PX", IdempotencyLockTTL.Milliseconds()))
+	if err == nil {
+		return true, nil, nil
+	}
+	if err != redis.ErrNil {
+		return false, nil, err
+	}
+	existing := &idempotencyRecord{}
+	data, err = redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		// 锁刚好过期，按处理中返回，客户端重试即可
+		return false, existing, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if err = json.Unmarshal(data, existing); err != nil {
+		return false, nil, err
+	}
+	return false, existing, nil
+}
+
+// replayIdempotency 重复请求返回首次的响应，请求体不同或仍在处理中时返回错误
+func replayIdempotency(ctx *gin.Context, hash string, existing *idempotencyRecord) {
+	defer ctx.Abort()
+	if existing.Hash != "" && existing.Hash != hash {
+		utils.Fail(ctx, errors.New("幂等键已用于其他请求"), utils.CodeConflict)
+		return
+	}
+	if !existing.Done {
+		utils.Fail(ctx, errors.New("请求处理中，请勿重复提交"), utils.CodeProcessing)
+		return
+	}
+	ctx.Header("Idempotent-Replayed", "true")
+	ctx.Data(existing.Status, existing.ContentType, existing.Body)
+}
+
+// idempotencySucceeded 响应是否成功，失败的响应不保存
+func idempotencySucceeded(status int, body []byte) bool {
+	if status >= 400 {
+		return false
+	}
+	var response utils.Response
+	if err := json.Unmarshal(body, &response); err == nil && response.Code != "" {
+		return response.Code == utils.CodeSuccess
+	}
+	return true
+}
+
+// setIdempotency 保存幂等键记录
+func setIdempotency(key string, record idempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	conn := redisConn()
+	defer conn.Close()
+	_, err = conn.Do("SET", key, data, "PX", ttl.Milliseconds())
+	return err
+}
+
+// releaseIdempotency 请求失败后删除幂等键，允许重试
+func releaseIdempotency(key string) {
+	conn := redisConn()
+	defer conn.Close()
+	if _, err := conn.Do("DEL", key); err != nil {
+		fmt.Println("idempotency del err:", err)
+	}
+}
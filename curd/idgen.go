@@ -0,0 +1,187 @@
+package curd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"github.com/lijianjunljj/gocommon/utils/id"
+	"gorm.io/gorm/schema"
+)
+
+// ID 生成策略
+const (
+	// IDUnixSeq 时间戳序列ID，字符串ID的默认策略
+	IDUnixSeq = "unix-seq"
+	// IDSonyflake Sonyflake 雪花ID
+	IDSonyflake = "sonyflake"
+	// IDUUIDv7 按时间排序的 UUID v7，36位，ID字段需声明为 varchar(36) 以上
+	IDUUIDv7 = "uuidv7"
+	// IDULID 按时间排序的 ULID
+	IDULID = "ulid"
+	// IDAuto 数据库自增，整数ID的默认策略
+	IDAuto = "auto"
+)
+
+// IDStrategy 模型声明ID生成策略，也可在 ID 字段上使用 id:"sonyflake" 标签
+type IDStrategy interface {
+	IDStrategy() string
+}
+
+// IDGenerator 模型自定义ID生成，优先于 IDStrategy
+type IDGenerator interface {
+	GenerateID() (interface{}, error)
+}
+
+var (
+	idGenerators = map[string]func() (interface{}, error){
+		IDSonyflake: func() (interface{}, error) {
+			return id.GetID()
+		},
+		IDUUIDv7: func() (interface{}, error) {
+			return id.UUIDv7()
+		},
+		IDULID: func() (interface{}, error) {
+			return id.ULID()
+		},
+	}
+	idGeneratorsMu sync.RWMutex
+)
+
+// RegisterIDGenerator 注册或覆盖ID生成策略，模型通过 IDStrategy 使用
+func RegisterIDGenerator(strategy string, generator func() (interface{}, error)) {
+	idGeneratorsMu.Lock()
+	defer idGeneratorsMu.Unlock()
+	idGenerators[strategy] = generator
+}
+
+// idStrategy 模型的ID生成策略，依次取 IDStrategy 接口、ID 字段的 id 标签，默认字符串ID为时间戳序列，整数ID为自增
+func idStrategy(model interface{}) string {
+	if strategy, ok := model.(IDStrategy); ok && strategy.IDStrategy() != "" {
+		return strategy.IDStrategy()
+	}
+	field, ok := reflect.TypeOf(model).Elem().FieldByName("ID")
+	if !ok {
+		return IDAuto
+	}
+	if tag := field.Tag.Get("id"); tag != "" {
+		return tag
+	}
+	if field.Type.Kind() == reflect.String {
+		return IDUnixSeq
+	}
+	return IDAuto
+}
+
+// generateIDs 按模型的策略生成 n 个ID，自增时返回 nil，ID超过字段长度时报错
+func (l *Logic) generateIDs(model interface{}, n int) ([]interface{}, error) {
+	ids, err := l.newIDs(model, n)
+	if err != nil {
+		return nil, err
+	}
+	if size := idColumnSize(model); size > 0 {
+		for _, value := range ids {
+			if str := utils.ToStr(value); len(str) > size {
+				return nil, fmt.Errorf("ID长度超过字段长度：%s 为%d位，ID字段为%d位", str, len(str), size)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// newIDs 按模型的策略生成 n 个ID，自增时返回 nil
+func (l *Logic) newIDs(model interface{}, n int) ([]interface{}, error) {
+	if generator, ok := model.(IDGenerator); ok {
+		return repeatGenerate(generator.GenerateID, n)
+	}
+	strategy := idStrategy(model)
+	switch strategy {
+	case IDAuto:
+		return nil, nil
+	case IDUnixSeq:
+		if l.svc.GetUnixID != nil {
+			return repeatGenerate(func() (interface{}, error) {
+				return l.svc.GetUnixID()
+			}, n)
+		}
+		ids, err := l.svc.IDRpc.GetUnixIDs(n)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, n)
+		for _, value := range ids {
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	idGeneratorsMu.RLock()
+	generator, ok := idGenerators[strategy]
+	idGeneratorsMu.RUnlock()
+	if !ok {
+		return nil, errors.New("ID生成策略不存在：" + strategy)
+	}
+	return repeatGenerate(generator, n)
+}
+
+// idColumnSize 字符串ID字段的列长度，取自 gorm 标签的 size 或 varchar(n)，未声明时返回 0
+func idColumnSize(model interface{}) int {
+	field, ok := reflect.TypeOf(model).Elem().FieldByName("ID")
+	if !ok || field.Type.Kind() != reflect.String {
+		return 0
+	}
+	settings := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+	if size, err := strconv.Atoi(settings["SIZE"]); err == nil {
+		return size
+	}
+	typ := strings.ToLower(settings["TYPE"])
+	if !strings.HasPrefix(typ, "varchar(") && !strings.HasPrefix(typ, "char(") {
+		return 0
+	}
+	typ = typ[strings.Index(typ, "(")+1:]
+	if i := strings.Index(typ, ")"); i >= 0 {
+		typ = typ[:i]
+	}
+	size, _ := strconv.Atoi(strings.TrimSpace(typ))
+	return size
+}
+
+// repeatGenerate 调用 n 次生成器
+func repeatGenerate(generator func() (interface{}, error), n int) ([]interface{}, error) {
+	values := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		value, err := generator()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// setID 按 ID 字段类型写入生成的ID
+func setID(field reflect.Value, value interface{}) error {
+	str := utils.ToStr(value)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(str)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil || field.OverflowUint(n) {
+			return errors.New("ID类型不匹配：" + str)
+		}
+		field.SetUint(n)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || field.OverflowInt(n) {
+			return errors.New("ID类型不匹配：" + str)
+		}
+		field.SetInt(n)
+	default:
+		return errors.New("不支持的ID类型：" + field.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package curd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportMaxRows 单次导入最大行数
+var ImportMaxRows = 10000
+
+// importSkipFields 导入时忽略的系统字段，由服务端生成，便于直接导入导出的文件
+var importSkipFields = map[string]bool{
+	"id": true, "create_by": true, "create_time": true, "update_time": true,
+	"delete_by": true, "delete_time": true, "deleted_at": true, "version": true, "tenant_id": true,
+}
+
+// ImportError 导入行错误，Row 为文件中的行号，表头为第1行
+type ImportError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportResult 导入结果，有错误行时不写入任何数据
+type ImportResult struct {
+	Total    int           `json:"total"`
+	Success  int           `json:"success"`
+	Failed   int           `json:"failed"`
+	Inserted int           `json:"inserted"`
+	DryRun   bool          `json:"dryRun"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// importColumn 导入列
+type importColumn struct {
+	header string
+	name   string
+	index  []int
+	layout string
+}
+
+// importColumns 按表头匹配模型字段，表头可以是 export 标签中的列名或 json 字段名，系统字段返回 nil
+func importColumns(t reflect.Type, headers []string) ([]*importColumn, error) {
+	fields := make(map[string]*importColumn)
+	skipped := make(map[string]bool)
+	for _, field := range reflect.VisibleFields(t) {
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		column := &importColumn{name: name, index: field.Index}
+		parts := strings.Split(field.Tag.Get("export"), ",")
+		for _, part := range parts[1:] {
+			if strings.HasPrefix(part, "format=") {
+				column.layout = timeLayouts[strings.TrimPrefix(part, "format=")]
+			}
+		}
+		if importSkipFields[name] {
+			skipped[name] = true
+			skipped[parts[0]] = true
+			continue
+		}
+		fields[name] = column
+		if parts[0] != "" {
+			fields[parts[0]] = column
+		}
+	}
+
+	columns := make([]*importColumn, len(headers))
+	for i, header := range headers {
+		header = strings.TrimSpace(header)
+		if header == "" || skipped[header] {
+			continue
+		}
+		field, ok := fields[header]
+		if !ok {
+			return nil, errors.New("导入列不存在：" + header)
+		}
+		columns[i] = &importColumn{header: header, name: field.name, index: field.index, layout: field.layout}
+	}
+	return columns, nil
+}
+
+// setCell 单元格文本转换为字段值，空单元格为零值
+func setCell(field reflect.Value, value string, layout string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Type() == timeType {
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setCell(elem.Elem(), value, layout); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil && layout != "" {
+			var t time.Time
+			if t, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+				n = t.Unix()
+			}
+		}
+		if err != nil {
+			return errors.New("不是有效的整数：" + value)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return errors.New("不是有效的整数：" + value)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return errors.New("不是有效的数字：" + value)
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		switch value {
+		case "是":
+			field.SetBool(true)
+		case "否":
+			field.SetBool(false)
+		default:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.New("不是有效的布尔值：" + value)
+			}
+			field.SetBool(b)
+		}
+	default:
+		if err := json.Unmarshal([]byte(value), field.Addr().Interface()); err != nil {
+			return errors.New("不是有效的JSON：" + value)
+		}
+	}
+	return nil
+}
+
+// parseTime 解析时间单元格
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{timeLayouts["datetime"], timeLayouts["date"]} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, errors.New("不是有效的时间：" + value)
+	}
+	return t, nil
+}
+
+// importValidate 按新增分组校验导入行，返回全部错误，列名使用表头
+func importValidate(row interface{}, rowNum int, columns []*importColumn) []ImportError {
+	err := utils.ValidateGroup(row, utils.ValidateCreate)
+	if err == nil {
+		return nil
+	}
+	fieldErrs, ok := err.(utils.FieldErrors)
+	if !ok {
+		return []ImportError{{Row: rowNum, Error: err.Error()}}
+	}
+	fields := make([]string, 0, len(fieldErrs))
+	for field := range fieldErrs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	errs := make([]ImportError, 0, len(fields))
+	for _, field := range fields {
+		header := field
+		for _, column := range columns {
+			if column != nil && column.name == field {
+				header = column.header
+				break
+			}
+		}
+		errs = append(errs, ImportError{Row: rowNum, Column: header, Error: fieldErrs[field]})
+	}
+	return errs
+}
+
+// isBlankRecord 是否空行
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readImportRows 读取导入文件的行，超过最大行数时多读一行后停止，xlsx 读取第一个工作表
+func readImportRows(format string, r io.Reader) ([][]string, error) {
+	switch format {
+	case ExportCSV:
+		reader := bufio.NewReader(r)
+		if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte("\xEF\xBB\xBF")) {
+			reader.Discard(3)
+		}
+		cr := csv.NewReader(reader)
+		cr.FieldsPerRecord = -1
+		// 逐行读取，超过最大行数即停止，不把整个文件读入内存
+		var records [][]string
+		for len(records) <= ImportMaxRows+1 {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	case ExportXLSX:
+		file, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		rows, err := file.Rows(file.GetSheetName(0))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var records [][]string
+		for rows.Next() {
+			record, err := rows.Columns()
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+			if len(records) > ImportMaxRows+1 {
+				break
+			}
+		}
+		return records, rows.Error()
+	}
+	return nil, errors.New("不支持的导入格式：" + format)
+}
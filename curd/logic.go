@@ -1,6 +1,7 @@
 package curd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -9,12 +10,17 @@ import (
 	"strings"
 
 	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
 )
 
 // Logic 逻辑层
 type Logic struct {
 	models interface{}
 	svc    *Service
+	// scopeKey 当前请求的数据范围，用于区分缓存
+	scopeKey string
+	// ctx 当前操作的上下文，随请求取消或超时
+	ctx context.Context
 }
 
 const (
@@ -23,21 +29,33 @@ const (
 	AttrTypeHealth
 )
 
-func parseSearch(search *Search) {
+// sortFieldPattern 排序字段只允许字母、数字和下划线，防止拼接到 ORDER BY 中注入
+var sortFieldPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseSearch 填充默认分页和排序，排序方向统一为小写的 asc 或 desc，排序字段或方向不合法时返回错误
+func parseSearch(search *Search) error {
 	if search.PageNum == 0 {
 		search.PageNum = 1
 	}
 	if search.PageSize == 0 {
 		search.PageSize = 10
 	}
-	if search.SortField == "" {
+	// 没有搜索关键词时无法按相关度排序
+	if search.SortField == "" || (search.SortField == SortRelevance && search.Keyword == "") {
 		search.SortField = "create_time"
 	}
 	if search.SortOrder == "" {
 		search.SortOrder = "desc"
 	}
-	search.SortOrder = strings.Replace(search.SortOrder, "end", "", 1)
+	search.SortOrder = strings.Replace(strings.ToLower(strings.TrimSpace(search.SortOrder)), "end", "", 1)
+	if search.SortOrder != "asc" && search.SortOrder != "desc" {
+		return utils.FieldErrors{"sortOrder": "排序方向只能为 asc 或 desc"}
+	}
+	if !sortFieldPattern.MatchString(search.SortField) {
+		return utils.FieldErrors{"sortField": "排序字段不合法"}
+	}
 	search.SortField = utils.CamelToLine(search.SortField)
+	return nil
 }
 
 // NewLogic 初始化逻辑
@@ -46,50 +64,142 @@ func NewLogic(service interface{}, models ...interface{}) *Logic {
 	if len(models) >= 1 {
 		mods = models[0]
 	}
-	return &Logic{
+	l := &Logic{
 		models: mods,
 		svc:    service.(*Service),
 	}
+	// 模型的读写使用其绑定的数据库
+	if setter, ok := l.svc.Model.(dbSetter); ok {
+		model := l.svc.Model
+		setter.setDB(databaseName(model), func() *gorm.DB {
+			return modelDB(model)
+		})
+	}
+	// 按请求的角色限制数据范围，查询、详情、修改、删除统一生效
+	if l.svc.Ctx != nil {
+		if setter, ok := l.svc.Model.(scopeSetter); ok {
+			scope, column, key := resolveScope(l.svc.Ctx, l.svc.Model)
+			l.scopeKey = key
+			setter.setScope(scope, column)
+		}
+		// 请求上下文中有事务时，模型的读写均在该事务中执行
+		if setter, ok := l.svc.Model.(txSetter); ok {
+			setter.setTx(l.ambientTx())
+		}
+	}
+	return l
 }
 
 // List 分页列表
 func (l *Logic) List(search *Search, isHook bool, extras ...Extra) (int64, error) {
-	parseSearch(search)
+	defer l.withContext(EndpointList)()
+	err := parseSearch(search)
+	if err != nil {
+		return 0, err
+	}
+	if search.Conditions, err = cleanConditions(search.Conditions); err != nil {
+		return 0, err
+	}
+
+	count, err := l.cachedList(cacheKind("list", isHook), search, func() (int64, error) {
+		return l.apiList(search, isHook, l.models)
+	})
+	if err != nil {
+		return count, err
+	}
+	if err = l.afterList(); err != nil {
+		return count, err
+	}
+	for _, extra := range extras {
+		err = extra(l.models)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// cleanConditions 校验查询参数并去掉空值条件
+func cleanConditions(conditions map[string]interface{}) (map[string]interface{}, error) {
 	var temp = make(map[string]interface{})
-	for key, value := range search.Conditions {
+	for key, value := range conditions {
 		str := utils.ToStr(value)
 		tp := reflect.TypeOf(value)
 		if tp.Kind().String() != "slice" {
 			if ok, _ := regexp.Match("^[\u4e00-\u9fa5a-zA-Z0-9_-]{0,}$", []byte(str)); !ok {
-				return 0, errors.New("查询参数包含非法字符")
+				return nil, errors.New("查询参数包含非法字符")
 			}
 		}
 		if str != "" {
 			temp[key] = value
 		}
 	}
-	search.Conditions = temp
+	return temp, nil
+}
 
-	count, err := l.svc.API.List(search, isHook, l.models)
+// Export 按游标分批读取列表数据，每批回调一次，避免一次加载全部数据
+func (l *Logic) Export(search *Search, batchSize int, fn func(models interface{}) error) error {
+	defer l.withContext(EndpointExport)()
+	err := parseSearch(search)
 	if err != nil {
-		return count, err
+		return err
 	}
-	for _, extra := range extras {
-		err = extra(l.models)
+	if search.Conditions, err = cleanConditions(search.Conditions); err != nil {
+		return err
+	}
+	search.UseCursor = true
+	search.CountMode = CountNone
+	search.PageSize = batchSize
+	search.Cursor = ""
+	sliceType := reflect.TypeOf(l.models).Elem()
+	for {
+		models := reflect.New(sliceType).Interface()
+		_, err = l.apiList(search, false, models)
 		if err != nil {
-			return count, err
+			return err
+		}
+		if reflect.ValueOf(models).Elem().Len() == 0 {
+			return nil
+		}
+		if err = fn(models); err != nil {
+			return err
+		}
+		if search.NextCursor == "" {
+			return nil
 		}
+		search.Cursor = search.NextCursor
 	}
-	return count, nil
+}
+
+// Aggregate 分组统计
+func (l *Logic) Aggregate(params *AggregateParams) ([]map[string]interface{}, error) {
+	defer l.withContext(EndpointAggregate)()
+	api, ok := l.svc.Model.(AggregateAPI)
+	if !ok {
+		return nil, errors.New("该模型不支持聚合统计")
+	}
+	var err error
+	if params.Conditions, err = cleanConditions(params.Conditions); err != nil {
+		return nil, err
+	}
+	return api.Aggregate(params, l.svc.Model)
 }
 
 // All 不分页列表
 func (l *Logic) All(search *Search, isHook bool, extras ...Extra) error {
-	parseSearch(search)
-	err := l.svc.API.All(search, isHook, l.models)
+	defer l.withContext(EndpointAll)()
+	if err := parseSearch(search); err != nil {
+		return err
+	}
+	_, err := l.cachedList(cacheKind("all", isHook), search, func() (int64, error) {
+		return 0, l.apiAll(search, isHook, l.models)
+	})
 	if err != nil {
 		return err
 	}
+	if err = l.afterList(); err != nil {
+		return err
+	}
 	for _, extra := range extras {
 		err = extra(l.models)
 		if err != nil {
@@ -101,6 +211,7 @@ func (l *Logic) All(search *Search, isHook bool, extras ...Extra) error {
 
 // Add 新增
 func (l *Logic) Add(userID string, extras ...Extra) error {
+	defer l.withContext(EndpointAdd)()
 	extraNum := len(extras)
 	if extraNum > 0 {
 		err := extras[0](l.svc.Model)
@@ -109,37 +220,71 @@ func (l *Logic) Add(userID string, extras ...Extra) error {
 		}
 	}
 
-	modelTypes := reflect.TypeOf(l.svc.Model).Elem()
-
-	id, _ := modelTypes.FieldByName("ID")
 	modelValue := reflect.ValueOf(l.svc.Model).Elem()
-	switch id.Type.String() {
-	case "string":
-		ID, err := l.svc.IDRpc.GetUnixID()
-		if err != nil {
+	ids, err := l.generateIDs(l.svc.Model, 1)
+	if err != nil {
+		return err
+	}
+	if ids != nil {
+		if err = setID(modelValue.FieldByName("ID"), ids[0]); err != nil {
 			return err
 		}
-		modelValue.FieldByName("ID").SetString(ID)
-		break
-	default:
-		break
 	}
 	modelValue.FieldByName("CreateBy").SetString(utils.ToStr(userID))
 	modelValue.FieldByName("CreateTime").SetInt(utils.TimeUnix())
 	modelValue.FieldByName("UpdateTime").SetInt(utils.TimeUnix())
 
-	err := l.svc.API.Add(l.svc.Model)
+	publish := isPublishable(l.svc.Model)
+	hooked := l.hasHooks(func(target interface{}) bool {
+		_, before := target.(BeforeAddHook)
+		_, after := target.(AfterAddHook)
+		return before || after
+	})
+	// 变更事件与新增在同一事务中写入发件箱
+	err = l.inTx(hooked || publish, func(tx *gorm.DB) error {
+		hc := &HookContext{Ctx: l.svc.Ctx, UserID: userID, Tx: tx, Model: l.svc.Model}
+		err := l.runHooks(func(target interface{}) error {
+			if hook, ok := target.(BeforeAddHook); ok {
+				return hook.BeforeAdd(hc)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = l.apiAdd(l.svc.Model); err != nil {
+			return err
+		}
+		err = l.runHooks(func(target interface{}) error {
+			if hook, ok := target.(AfterAddHook); ok {
+				return hook.AfterAdd(hc)
+			}
+			return nil
+		})
+		if err != nil || !publish {
+			return err
+		}
+		return l.writeEvent(tx, EventCreated, l.svc.Model, nil, l.svc.Model)
+	})
+	if err != nil {
+		return err
+	}
+	l.invalidateCache()
+	if isAuditable(l.svc.Model) {
+		l.audit(AuditAdd, l.svc.Model, nil, l.svc.Model)
+	}
 	if extraNum > 1 {
 		err = extras[1](l.svc.Model)
 		if err != nil {
 			return err
 		}
 	}
-	return err
+	return nil
 }
 
 // Edit 修改
 func (l *Logic) Edit(extras ...Extra) error {
+	defer l.withContext(EndpointEdit)()
 	mv := reflect.ValueOf(l.svc.Model).Elem()
 
 	modelTypes := reflect.TypeOf(l.svc.Model).Elem()
@@ -167,20 +312,111 @@ func (l *Logic) Edit(extras ...Extra) error {
 			return err
 		}
 	}
+	var before interface{}
+	audit := isAuditable(l.svc.Model)
+	publish := isPublishable(l.svc.Model)
+	if audit || publish {
+		before = l.original()
+	}
 	modelValue := reflect.ValueOf(l.svc.Model).Elem()
 	modelValue.FieldByName("UpdateTime").SetInt(utils.TimeUnix())
-	err := l.svc.API.Edit(l.svc.Model)
+	err := l.edit(publish, func(tx *gorm.DB) error {
+		if err := l.apiEdit(l.svc.Model); err != nil || !publish {
+			return err
+		}
+		return l.writeEvent(tx, EventUpdated, l.svc.Model, before, l.svc.Model)
+	})
+	if err != nil {
+		return err
+	}
+	l.invalidateCache(l.modelID())
+	if audit {
+		l.audit(AuditEdit, l.svc.Model, before, l.svc.Model)
+	}
 	if extraNum > 1 {
 		err = extras[1](l.svc.Model)
 		if err != nil {
 			return err
 		}
 	}
-	return err
+	return nil
+}
+
+// Patch 局部更新，fields 为请求中出现的 json 字段
+func (l *Logic) Patch(fields []string, extras ...Extra) error {
+	defer l.withContext(EndpointPatch)()
+	api, ok := l.svc.Model.(PatchAPI)
+	if !ok {
+		return errors.New("该模型不支持局部更新")
+	}
+	if ID := reflect.ValueOf(l.svc.Model).Elem().FieldByName("ID"); !ID.IsValid() || ID.IsZero() {
+		return errors.New("ID不能为空")
+	}
+	extraNum := len(extras)
+	if extraNum > 0 {
+		err := extras[0](l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	var before interface{}
+	audit := isAuditable(l.svc.Model)
+	publish := isPublishable(l.svc.Model)
+	if audit || publish {
+		before = l.original()
+	}
+	reflect.ValueOf(l.svc.Model).Elem().FieldByName("UpdateTime").SetInt(utils.TimeUnix())
+	err := l.edit(publish, func(tx *gorm.DB) error {
+		if err := api.Patch(l.svc.Model, fields); err != nil || !publish {
+			return err
+		}
+		return l.writeEvent(tx, EventUpdated, l.svc.Model, before, l.original())
+	})
+	if err != nil {
+		return err
+	}
+	l.invalidateCache(l.modelID())
+	if audit {
+		l.audit(AuditEdit, l.svc.Model, before, l.original())
+	}
+	if extraNum > 1 {
+		err = extras[1](l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Detail 详情
 func (l *Logic) Detail(extras ...Extra) error {
+	defer l.withContext(EndpointDetail)()
+	err := l.cachedDetail()
+	if err != nil {
+		return err
+	}
+	hc := &HookContext{Ctx: l.svc.Ctx, UserID: l.userID(), Model: l.svc.Model}
+	err = l.runHooks(func(target interface{}) error {
+		if hook, ok := target.(AfterDetailHook); ok {
+			return hook.AfterDetail(hc)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, extra := range extras {
+		err = extra(l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detail 按ID读取记录，不执行钩子，用于修改前加载原数据
+func (l *Logic) detail() error {
+	defer l.withContext(EndpointDetail)()
 	mv := reflect.ValueOf(l.svc.Model).Elem()
 
 	modelTypes := reflect.TypeOf(l.svc.Model).Elem()
@@ -204,15 +440,175 @@ func (l *Logic) Detail(extras ...Extra) error {
 		break
 	}
 
-	err := l.svc.API.Detail(l.svc.Model)
-	for _, extra := range extras {
-		extra(l.svc.Model)
-	}
-	return err
+	return l.apiDetail(l.svc.Model)
 }
 
 // Delete 删除
 func (l *Logic) Delete(str string, extras ...Extra) error {
+	defer l.withContext(EndpointDelete)()
+	userID := l.userID()
+	soft := isSoftDelete(l.svc.Model)
+	audit := isAuditable(l.svc.Model)
+	publish := isPublishable(l.svc.Model)
+	hooked := l.hasHooks(func(target interface{}) bool {
+		_, before := target.(BeforeDeleteHook)
+		_, after := target.(AfterDeleteHook)
+		return before || after
+	})
+	// 审计在事务提交后记录，回滚的删除不留记录
+	var audits [][2]interface{}
+	err := l.inTx(hooked || publish, func(tx *gorm.DB) error {
+		hc := &HookContext{Ctx: l.svc.Ctx, UserID: userID, Tx: tx, Model: l.svc.Model}
+		return l.eachID(str, func(mv reflect.Value) error {
+			var before interface{}
+			if audit || publish {
+				before = l.original()
+			}
+			if audit {
+				deleted := reflect.New(mv.Type())
+				deleted.Elem().Set(mv)
+				audits = append(audits, [2]interface{}{deleted.Interface(), before})
+			}
+			if soft {
+				mv.FieldByName("DeleteBy").SetString(userID)
+				mv.FieldByName("DeleteTime").SetInt(utils.TimeUnix())
+			}
+			err := l.runHooks(func(target interface{}) error {
+				if hook, ok := target.(BeforeDeleteHook); ok {
+					return hook.BeforeDelete(hc)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if err = l.apiDelete(l.svc.Model); err != nil {
+				return err
+			}
+			err = l.runHooks(func(target interface{}) error {
+				if hook, ok := target.(AfterDeleteHook); ok {
+					return hook.AfterDelete(hc)
+				}
+				return nil
+			})
+			if err != nil || !publish {
+				return err
+			}
+			return l.writeEvent(tx, EventDeleted, l.svc.Model, before, nil)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	l.invalidateCache(StrToSlice(str)...)
+	for _, item := range audits {
+		l.audit(AuditDelete, item[0], item[1], nil)
+	}
+
+	for _, extra := range extras {
+		err := extra(l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trash 回收站列表
+func (l *Logic) Trash(search *Search, isHook bool, extras ...Extra) (int64, error) {
+	defer l.withContext(EndpointTrash)()
+	api, err := l.trashAPI()
+	if err != nil {
+		return 0, err
+	}
+	if err = parseSearch(search); err != nil {
+		return 0, err
+	}
+	count, err := api.Trash(search, isHook, l.models)
+	if err != nil {
+		return count, err
+	}
+	for _, extra := range extras {
+		err = extra(l.models)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Restore 恢复
+func (l *Logic) Restore(str string, extras ...Extra) error {
+	defer l.withContext(EndpointRestore)()
+	api, err := l.trashAPI()
+	if err != nil {
+		return err
+	}
+	publish := isPublishable(l.svc.Model)
+	err = l.inTx(publish, func(tx *gorm.DB) error {
+		return l.eachID(str, func(mv reflect.Value) error {
+			if err := api.Restore(l.svc.Model); err != nil || !publish {
+				return err
+			}
+			return l.writeEvent(tx, EventRestored, l.svc.Model, nil, l.loadRow(tx, l.svc.Model))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	l.invalidateCache(StrToSlice(str)...)
+	for _, extra := range extras {
+		err = extra(l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge 彻底删除
+func (l *Logic) Purge(str string, extras ...Extra) error {
+	defer l.withContext(EndpointPurge)()
+	api, err := l.trashAPI()
+	if err != nil {
+		return err
+	}
+	publish := isPublishable(l.svc.Model)
+	err = l.inTx(publish, func(tx *gorm.DB) error {
+		return l.eachID(str, func(mv reflect.Value) error {
+			var before interface{}
+			if publish {
+				before = l.loadRow(l.eventDB(tx).Unscoped(), l.svc.Model)
+			}
+			if err := api.Purge(l.svc.Model); err != nil || !publish {
+				return err
+			}
+			return l.writeEvent(tx, EventPurged, l.svc.Model, before, nil)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, extra := range extras {
+		err = extra(l.svc.Model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashAPI 获取回收站服务，模型未开启软删除时返回错误
+func (l *Logic) trashAPI() (TrashAPI, error) {
+	api, ok := l.svc.Model.(TrashAPI)
+	if !ok || !isSoftDelete(l.svc.Model) {
+		return nil, errors.New("该模型不支持软删除")
+	}
+	return api, nil
+}
+
+// eachID 逐个设置模型ID并执行操作
+func (l *Logic) eachID(str string, fn func(mv reflect.Value) error) error {
 	modelTypes := reflect.TypeOf(l.svc.Model).Elem()
 	id, _ := modelTypes.FieldByName("ID")
 	ids := StrToSlice(str)
@@ -238,17 +634,419 @@ func (l *Logic) Delete(str string, extras ...Extra) error {
 			break
 		}
 
-		err := l.svc.API.Delete(l.svc.Model)
+		err := fn(mv)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+// History 单条记录的变更历史，记录需在当前用户的数据范围和租户内
+func (l *Logic) History(id string) ([]AuditLog, error) {
+	defer l.withContext(EndpointHistory)()
+	if id == "" {
+		return nil, errors.New("ID不能为空")
+	}
+	history, ok := auditSink.(AuditHistory)
+	if !ok {
+		return nil, errors.New("审计记录不支持查询")
+	}
+	err := l.eachID(id, func(mv reflect.Value) error {
+		if checker, ok := l.svc.Model.(recordChecker); ok {
+			return checker.exists(l.svc.Model)
+		}
+		return l.detail()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history.History(modelName(l.svc.Model), id)
+}
+
+// original 从数据库读取当前记录，用于审计前后对比
+func (l *Logic) original() interface{} {
+	before := reflect.New(reflect.TypeOf(l.svc.Model).Elem())
+	before.Elem().FieldByName("ID").Set(reflect.ValueOf(l.svc.Model).Elem().FieldByName("ID"))
+	if err := l.apiDetail(before.Interface()); err != nil {
+		return nil
+	}
+	return before.Interface()
+}
+
+// userID 当前操作用户ID
+func (l *Logic) userID() string {
+	if l.svc.Ctx == nil {
+		return ""
+	}
+	return l.svc.Ctx.GetString("userID")
+}
 
+// BatchAdd 批量新增，partial 为 true 时允许部分失败并返回每条结果
+func (l *Logic) BatchAdd(userID string, partial bool, extras ...Extra) (*BatchResults, error) {
+	defer l.withContext(EndpointBatchAdd)()
+	api, ok := l.svc.Model.(BatchAPI)
+	if !ok {
+		return nil, errors.New("该模型不支持批量操作")
+	}
+	rows := reflect.Indirect(reflect.ValueOf(l.models))
+	if rows.Kind() != reflect.Slice || rows.Len() == 0 {
+		return nil, errors.New("数据不能为空")
+	}
+	err := l.stampRows(rows, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := l.txn()
+	var results *BatchResults
+	if partial {
+		results = l.eachRow(txn.Tx, rows, func(row interface{}) error {
+			if err := l.rowHook(txn.Tx, row, userID, beforeAdd); err != nil {
+				return err
+			}
+			if err := api.BatchAdd(txn.Tx, row, 1); err != nil {
+				return err
+			}
+			if err := l.rowHook(txn.Tx, row, userID, afterAdd); err != nil || !isPublishable(l.svc.Model) {
+				return err
+			}
+			return l.writeEvent(txn.Tx, EventCreated, row, nil, row)
+		})
+	} else {
+		if err = l.addRows(txn.Tx, api, rows, userID); err != nil {
+			txn.TryRollback()
+			return nil, err
+		}
+		results = l.eachRow(nil, rows, nil)
+	}
+	if err = txn.TryCommit(); err != nil {
+		return nil, err
+	}
+	l.invalidateCache()
 	for _, extra := range extras {
-		err := extra(l.svc.Model)
+		err = extra(l.models)
 		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// addRows 在事务中分批新增，逐条执行新增前后的钩子并写入变更事件
+func (l *Logic) addRows(tx *gorm.DB, api BatchAPI, rows reflect.Value, userID string) error {
+	if err := l.rowHooks(tx, rows, userID, beforeAdd); err != nil {
+		return err
+	}
+	if err := api.BatchAdd(tx, rows.Addr().Interface(), BatchSize); err != nil {
+		return err
+	}
+	if err := l.rowHooks(tx, rows, userID, afterAdd); err != nil || !isPublishable(l.svc.Model) {
+		return err
+	}
+	for i := 0; i < rows.Len(); i++ {
+		row := rowAt(rows, i).Interface()
+		if err := l.writeEvent(tx, EventCreated, row, nil, row); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// stampRows 批量新增前设置ID、创建人和时间
+func (l *Logic) stampRows(rows reflect.Value, userID string) error {
+	rowType := rows.Type().Elem()
+	if rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	ids, err := l.generateIDs(reflect.New(rowType).Interface(), rows.Len())
+	if err != nil {
+		return err
+	}
+	now := utils.TimeUnix()
+	for i := 0; i < rows.Len(); i++ {
+		row := rowAt(rows, i).Elem()
+		if ids != nil {
+			if err = setID(row.FieldByName("ID"), ids[i]); err != nil {
+				return err
+			}
+		}
+		row.FieldByName("CreateBy").SetString(userID)
+		row.FieldByName("CreateTime").SetInt(now)
+		row.FieldByName("UpdateTime").SetInt(now)
+	}
+	return nil
+}
+
+// Import 导入表格数据，第一行为表头，逐行转换并校验，全部通过时在一个事务内分批写入
+func (l *Logic) Import(userID string, records [][]string, dryRun bool, extras ...Extra) (*ImportResult, error) {
+	defer l.withContext(EndpointImport)()
+	api, ok := l.svc.Model.(BatchAPI)
+	if !ok {
+		return nil, errors.New("该模型不支持批量操作")
+	}
+	if len(records) < 2 {
+		return nil, errors.New("导入数据不能为空")
+	}
+	if len(records)-1 > ImportMaxRows {
+		return nil, fmt.Errorf("单次最多导入%d行", ImportMaxRows)
+	}
+	rowType, err := rowTypeOf(l.models)
+	if err != nil {
+		return nil, err
+	}
+	rows := reflect.ValueOf(l.models).Elem()
+	isPtr := rows.Type().Elem().Kind() == reflect.Ptr
+	columns, err := importColumns(rowType, records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{DryRun: dryRun, Errors: []ImportError{}}
+	valid := reflect.MakeSlice(rows.Type(), 0, len(records)-1)
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		result.Total++
+		rowNum := i + 2
+		row := reflect.New(rowType).Elem()
+		failed := false
+		for j, column := range columns {
+			if column == nil || j >= len(record) {
+				continue
+			}
+			if err = setCell(row.FieldByIndex(column.index), record[j], column.layout); err != nil {
+				result.Errors = append(result.Errors, ImportError{Row: rowNum, Column: column.header, Error: err.Error()})
+				failed = true
+			}
+		}
+		if !failed {
+			if errs := importValidate(row.Addr().Interface(), rowNum, columns); len(errs) > 0 {
+				result.Errors = append(result.Errors, errs...)
+				failed = true
+			}
+		}
+		if failed {
+			result.Failed++
+			continue
+		}
+		result.Success++
+		if isPtr {
+			valid = reflect.Append(valid, row.Addr())
+		} else {
+			valid = reflect.Append(valid, row)
+		}
+	}
+	if dryRun || result.Failed > 0 || valid.Len() == 0 {
+		return result, nil
+	}
+
+	if err = l.stampRows(valid, userID); err != nil {
+		return nil, err
+	}
+	rows.Set(valid)
+	txn := l.txn()
+	if err = l.addRows(txn.Tx, api, rows, userID); err != nil {
+		txn.TryRollback()
+		return nil, err
+	}
+	if err = txn.TryCommit(); err != nil {
+		return nil, err
+	}
+	result.Inserted = valid.Len()
+	l.invalidateCache()
+	for _, extra := range extras {
+		err = extra(l.models)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// BatchEdit 批量编辑，仅更新非零值字段
+func (l *Logic) BatchEdit(partial bool, extras ...Extra) (*BatchResults, error) {
+	defer l.withContext(EndpointBatchEdit)()
+	api, ok := l.svc.Model.(BatchAPI)
+	if !ok {
+		return nil, errors.New("该模型不支持批量操作")
+	}
+	rows := reflect.Indirect(reflect.ValueOf(l.models))
+	if rows.Kind() != reflect.Slice || rows.Len() == 0 {
+		return nil, errors.New("数据不能为空")
+	}
+	now := utils.TimeUnix()
+	for i := 0; i < rows.Len(); i++ {
+		rowAt(rows, i).Elem().FieldByName("UpdateTime").SetInt(now)
+	}
+
+	userID := l.userID()
+	publish := isPublishable(l.svc.Model)
+	txn := l.txn()
+	edit := func(row interface{}) error {
+		if rv := reflect.ValueOf(row).Elem().FieldByName("ID"); rv.IsZero() {
+			return errors.New("ID不能为空")
+		}
+		// 只更新非零值字段，变更事件使用更新前后从数据库读取的完整记录
+		var before interface{}
+		if publish {
+			before = l.loadRow(txn.Tx, row)
+		}
+		if err := l.rowHook(txn.Tx, row, userID, beforeEdit); err != nil {
+			return err
+		}
+		if err := api.BatchEdit(txn.Tx, row); err != nil {
+			return err
+		}
+		if err := l.rowHook(txn.Tx, row, userID, afterEdit); err != nil || !publish {
+			return err
+		}
+		return l.writeEvent(txn.Tx, EventUpdated, row, before, l.loadRow(txn.Tx, row))
+	}
+	var results *BatchResults
+	if partial {
+		results = l.eachRow(txn.Tx, rows, edit)
+	} else {
+		for i := 0; i < rows.Len(); i++ {
+			if err := edit(rowAt(rows, i).Interface()); err != nil {
+				txn.TryRollback()
+				return nil, fmt.Errorf("第%d条数据：%s", i+1, err.Error())
+			}
+		}
+		results = l.eachRow(nil, rows, nil)
+	}
+	if err := txn.TryCommit(); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		ids = append(ids, utils.ToStr(rowAt(rows, i).Elem().FieldByName("ID").Interface()))
+	}
+	l.invalidateCache(ids...)
+	for _, extra := range extras {
+		err := extra(l.models)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// BatchDelete 批量删除，一条语句删除全部ID
+func (l *Logic) BatchDelete(ids []string, extras ...Extra) (int64, error) {
+	defer l.withContext(EndpointBatchDelete)()
+	api, ok := l.svc.Model.(BatchAPI)
+	if !ok {
+		return 0, errors.New("该模型不支持批量操作")
+	}
+	if len(ids) == 0 {
+		return 0, errors.New("ID不能为空")
+	}
+	userID := l.userID()
+	model := reflect.New(reflect.TypeOf(l.svc.Model).Elem()).Interface()
+	if isSoftDelete(model) {
+		mv := reflect.ValueOf(model).Elem()
+		mv.FieldByName("DeleteBy").SetString(userID)
+		mv.FieldByName("DeleteTime").SetInt(utils.TimeUnix())
+	}
+	// 有删除钩子或需要发布变更事件时为每个ID构造一条数据，删除仍为一条语句
+	hooked := l.hasHooks(func(target interface{}) bool {
+		_, before := target.(BeforeDeleteHook)
+		_, after := target.(AfterDeleteHook)
+		return before || after
+	})
+	publish := isPublishable(l.svc.Model)
+	var rows reflect.Value
+	if hooked || publish {
+		rows = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(model).Elem()), len(ids), len(ids))
+		for i, id := range ids {
+			rows.Index(i).Set(reflect.ValueOf(model).Elem())
+			if err := setID(rows.Index(i).FieldByName("ID"), id); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	txn := l.txn()
+	var count int64
+	err := func() error {
+		if hooked {
+			if err := l.rowHooks(txn.Tx, rows, userID, beforeDelete); err != nil {
+				return err
+			}
+		}
+		var befores []interface{}
+		if publish {
+			for i := 0; i < rows.Len(); i++ {
+				befores = append(befores, l.loadRow(txn.Tx, rowAt(rows, i).Interface()))
+			}
+		}
+		var err error
+		if count, err = api.BatchDelete(txn.Tx, model, ids); err != nil {
+			return err
+		}
+		if hooked {
+			if err = l.rowHooks(txn.Tx, rows, userID, afterDelete); err != nil {
+				return err
+			}
+		}
+		// 不存在或不在数据范围内的ID没有删除，不写入事件
+		for i, before := range befores {
+			if before == nil {
+				continue
+			}
+			if err = l.writeEvent(txn.Tx, EventDeleted, rowAt(rows, i).Interface(), before, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		txn.TryRollback()
+		return 0, err
+	}
+	if err = txn.TryCommit(); err != nil {
+		return 0, err
+	}
+	l.invalidateCache(ids...)
+	for _, extra := range extras {
+		err = extra(model)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// eachRow 逐条执行批量操作并汇总结果，tx 不为空时每条使用保存点隔离失败
+func (l *Logic) eachRow(tx *gorm.DB, rows reflect.Value, fn func(row interface{}) error) *BatchResults {
+	results := &BatchResults{Items: make([]BatchResult, 0, rows.Len())}
+	for i := 0; i < rows.Len(); i++ {
+		row := rowAt(rows, i).Interface()
+		item := BatchResult{Index: i}
+		if fn != nil {
+			var err error
+			if tx != nil {
+				savepoint := fmt.Sprintf("batch_%d", i)
+				tx.SavePoint(savepoint)
+				if err = fn(row); err != nil {
+					tx.RollbackTo(savepoint)
+				}
+			} else {
+				err = fn(row)
+			}
+			if err != nil {
+				item.Error = translateError(err, row).Error()
+			}
+		}
+		item.ID = rowAt(rows, i).Elem().FieldByName("ID").Interface()
+		if item.Error == "" {
+			results.Success++
+		} else {
+			results.Failed++
+		}
+		results.Items = append(results.Items, item)
+	}
+	return results
+}
@@ -1,6 +1,7 @@
 package curd
 
 import (
+	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -24,13 +25,25 @@ type Search struct {
 	Conditions map[string]interface{} `json:"conditions"`
 	SortField  string                 `json:"sortField"`
 	SortOrder  string                 `json:"sortOrder"`
+	// UseCursor 开启游标分页，以 Cursor 代替 PageNum 翻页
+	UseCursor bool   `json:"useCursor"`
+	Cursor    string `json:"cursor"`
+	// CountMode 总数统计模式：空为精确统计，none 不统计，estimate 估算
+	CountMode string `json:"countMode"`
+	// Fields 只查询的字段，为空时查询全部字段
+	Fields []string `json:"fields"`
+	// Include 预加载的关联，需在模型 Includes 白名单内
+	Include []string `json:"include"`
+	// Keyword 在模型的全文搜索字段中搜索，SortField 为 relevance 时按相关度排序
+	Keyword    string `json:"keyword"`
+	NextCursor string `json:"-"`
 }
 
 func (that *Search) Check() error {
 	if that.PageSize >= 100 {
 		return errors.New("参数错误")
 	}
-	if that.PageNum >= 100 {
+	if !that.UseCursor && that.PageNum >= 100 {
 		return errors.New("参数错误")
 	}
 	return nil
@@ -38,22 +51,36 @@ func (that *Search) Check() error {
 
 // Model 基础模型
 type Model struct {
-	ID         string `json:"id" gorm:"type:varchar(30);primary_key"`
+	ID         string `json:"id" gorm:"type:varchar(30);primary_key" validate_update:"required"`
 	CreateBy   string `json:"create_by" gorm:"type:varchar(30)"`
 	CreateTime int64  `json:"create_time"`
 	UpdateTime int64  `json:"update_time"`
 	IsChanged  int8   `json:"is_changed" gorm:"type:tinyint(4) DEFAULT 0"`
 	mysql      func() *gorm.DB
 	where      string
+	scope      func(db *gorm.DB) *gorm.DB
+	// scopeColumn 数据范围字段，修改时不允许变更
+	scopeColumn string
+	// database 绑定的数据库名，只加入该数据库的上下文事务
+	database string
+	tx       *gorm.DB
+	ctx      context.Context
 }
 
 type ModelIdInt struct {
-	ID         uint64 `json:"id"          gorm:"primary_key;AUTO_INCREMENT"`
+	ID         uint64 `json:"id"          gorm:"primary_key;AUTO_INCREMENT" validate_update:"required"`
 	CreateBy   string `json:"-" gorm:"type:varchar(30)"`
 	CreateTime int64  `json:"-"`
 	UpdateTime int64  `json:"-"`
 	mysql      func() *gorm.DB
 	where      string
+	scope      func(db *gorm.DB) *gorm.DB
+	// scopeColumn 数据范围字段，修改时不允许变更
+	scopeColumn string
+	// database 绑定的数据库名，只加入该数据库的上下文事务
+	database string
+	tx       *gorm.DB
+	ctx      context.Context
 }
 
 // Where 设置查询条件
@@ -62,12 +89,23 @@ func (m *ModelIdInt) Where(where string) *ModelIdInt {
 	return m
 }
 
+// base 对应的字符串ID基础模型，ModelIdInt 的方法均委托给 Model
+func (m *ModelIdInt) base() *Model {
+	return &Model{
+		ID:          strconv.FormatUint(m.ID, 10),
+		where:       m.where,
+		scope:       m.scope,
+		scopeColumn: m.scopeColumn,
+		mysql:       m.mysql,
+		database:    m.database,
+		tx:          m.tx,
+		ctx:         m.ctx,
+	}
+}
+
 // Query 解析参数链式查询
 func (m *ModelIdInt) Query(search *Search, isHook bool, model interface{}, isPages bool) (int64, error) {
-	modelBase := &Model{
-		ID:    strconv.FormatUint(m.ID, 10),
-		where: m.where,
-	}
+	modelBase := m.base()
 	return modelBase.Query(search, isHook, model, isPages)
 }
 
@@ -84,27 +122,25 @@ func (m *ModelIdInt) All(search *Search, isHook bool, models interface{}) error
 
 // Detail 通用详情查询
 func (m *ModelIdInt) Detail(model interface{}) error {
-	modelBase := &Model{
-		ID: strconv.FormatUint(m.ID, 10),
-	}
+	modelBase := m.base()
 	return modelBase.Detail(model)
 }
 
 // Add 通用新增功能
 func (m *ModelIdInt) Add(model interface{}) error {
-	modelBase := &Model{}
+	modelBase := m.base()
 	return modelBase.Add(model)
 }
 
 // Edit 通用编辑功能
 func (m *ModelIdInt) Edit(model interface{}) error {
-	modelBase := &Model{}
+	modelBase := m.base()
 	return modelBase.Edit(model)
 }
 
 // Delete 通用删除功能
 func (m *ModelIdInt) Delete(model interface{}) error {
-	modelBase := &Model{}
+	modelBase := m.base()
 	return modelBase.Delete(model)
 }
 
@@ -139,9 +175,21 @@ func (m *Model) Where(where string) *Model {
 
 // Query 解析参数链式查询
 func (m *Model) Query(search *Search, isHook bool, model interface{}, isPages bool) (int64, error) {
-	var count int64
-	db := mysql().Model(model)
-	for key, value := range search.Conditions {
+	return m.query(m.db().Model(model), search, isHook, model, isPages)
+}
+
+// query 在指定查询上解析参数链式查询
+func (m *Model) query(db *gorm.DB, search *Search, isHook bool, model interface{}, isPages bool) (int64, error) {
+	db = conditionQuery(db, search.Conditions)
+	if m.where != "" {
+		db = db.Where(m.where)
+	}
+	return pageQuery(db, search, model, isPages, isHook)
+}
+
+// conditionQuery 解析查询条件，字符串模糊匹配，切片范围匹配
+func conditionQuery(db *gorm.DB, conditions map[string]interface{}) *gorm.DB {
+	for key, value := range conditions {
 		fieldName := utils.CamelToLine(key)
 		str := utils.ToStr(value)
 		tp := reflect.TypeOf(value)
@@ -159,42 +207,61 @@ func (m *Model) Query(search *Search, isHook bool, model interface{}, isPages bo
 			db = db.Where(fieldName+" =  ?", str)
 		}
 	}
+	return db
+}
 
-	if m.where != "" {
-		db = db.Where(m.where)
+// List 通用分页列表查询
+func (m *Model) List(search *Search, isHook bool, models interface{}) (int64, error) {
+	return m.Query(search, isHook, models, true)
+}
+
+// All 通用所有列表查询
+func (m *Model) All(search *Search, isHook bool, models interface{}) error {
+	_, err := m.Query(search, isHook, models, false)
+	return err
+}
+
+// pageQuery 排序分页并执行查询
+func pageQuery(db *gorm.DB, search *Search, model interface{}, isPages bool, isHook bool) (int64, error) {
+	var count int64
+	db, err := selectFields(db, search, model)
+	if err != nil {
+		return count, err
+	}
+	db, sorted, err := keywordQuery(db, search, model)
+	if err != nil {
+		return count, err
+	}
+	if isPages && search.UseCursor {
+		return cursorQuery(db, search, model, isHook)
+	}
+	// 排序
+	if !sorted {
+		db = db.Order(search.SortField + " " + search.SortOrder)
 	}
-	db = db.Order(search.SortField + " " + search.SortOrder)
 	var result *gorm.DB
+	// 分页处理
 	if isPages {
-		result = db.Count(&count)
-		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return count, result.Error
+		count, err = countQuery(db, search, model)
+		if err != nil {
+			return count, err
 		}
 		db = db.Offset((search.PageNum - 1) * search.PageSize).Limit(search.PageSize)
 	}
+	db = preloadIncludes(db, search)
+	// 钩子处理
 	if isHook {
 		result = db.Find(model)
 	} else {
 		result = db.Session(&gorm.Session{SkipHooks: true}).Find(model)
 	}
-
+	// 无记录
 	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return count, result.Error
 	}
 	return count, nil
 }
 
-// List 通用分页列表查询
-func (m *Model) List(search *Search, isHook bool, models interface{}) (int64, error) {
-	return m.Query(search, isHook, models, true)
-}
-
-// All 通用所有列表查询
-func (m *Model) All(search *Search, isHook bool, models interface{}) error {
-	_, err := m.Query(search, isHook, models, false)
-	return err
-}
-
 // Detail 通用详情查询
 func (m *Model) Detail(model interface{}) error {
 	// 直接使用 First，GORM 会根据模型的主键字段自动处理
@@ -224,24 +291,73 @@ func (m *Model) Detail(model interface{}) error {
 	}
 
 	// 直接使用 First，GORM 会根据模型的主键字段自动处理
-	result := mysql().First(model)
+	result := m.db().First(model)
 	return result.Error
 }
 
 // Add 通用新增功能
 func (m *Model) Add(model interface{}) error {
-	result := mysql().Omit(clause.Associations).Create(model)
+	result := m.conn().Omit(clause.Associations).Create(model)
 	return result.Error
 }
 
-// Edit 通用编辑功能
+// Edit 通用编辑功能，模型有 Version 字段时按版本号乐观锁更新，创建人、数据范围、租户等字段不更新，
+// 记录不存在时返回 gorm.ErrRecordNotFound，不会像 Save 一样插入新记录
 func (m *Model) Edit(model interface{}) error {
-	result := mysql().Omit(clause.Associations).Save(model)
-	return result.Error
+	if err := m.inScope(m.conn(), model); err != nil {
+		return err
+	}
+	omit, err := immutableColumns(m.conn(), model, m.scopeColumn)
+	if err != nil {
+		return err
+	}
+	db := m.conn().Omit(append(omit, clause.Associations)...)
+	if version, ok := versionField(model); ok {
+		return updateWithVersion(db, model, version, "*")
+	}
+	result := db.Model(model).Select("*").Updates(model)
+	return m.updated(result, model)
 }
 
-// Delete 通用删除功能
+// Delete 通用删除功能，记录不存在时返回 gorm.ErrRecordNotFound
 func (m *Model) Delete(model interface{}) error {
-	result := mysql().Debug().Delete(model)
-	return result.Error
+	if err := m.inScope(m.conn(), model); err != nil {
+		return err
+	}
+	if soft, ok := model.(SoftDeleter); ok {
+		if soft.SoftDelete() {
+			return softDelete(m.conn(), model)
+		}
+		return affected(m.conn().Unscoped().Delete(model))
+	}
+	result := m.conn().Debug().Delete(model)
+	return affected(result)
+}
+
+// updated 检查修改结果，没有影响任何记录时确认记录是否存在，MySQL 对值未变化的记录也返回 0
+func (m *Model) updated(result *gorm.DB, model interface{}) error {
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	var count int64
+	id := reflect.ValueOf(model).Elem().FieldByName("ID").Interface()
+	err := m.db().Model(model).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// affected 检查语句执行结果，没有影响任何记录时返回 gorm.ErrRecordNotFound
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
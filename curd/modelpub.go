@@ -1,7 +1,6 @@
 package curd
 
 import (
-	"errors"
 	util "github.com/lijianjunljj/gocommon/utils"
 	"gorm.io/gorm"
 	"reflect"
@@ -35,8 +34,9 @@ func IsInArray(str string, array []string) bool {
 // SearchQuery 解析参数链式查询
 func SearchQuery(db *gorm.DB, search *Search, model interface{}, fuzzyfieldarray []string, isPages bool, isHook bool, fuzzySearchAllow bool) (int64, error) {
 	// 初始化搜索参数
-	parseSearch(search)
-	var count int64
+	if err := parseSearch(search); err != nil {
+		return 0, err
+	}
 	// 搜索参数
 	for key, value := range search.Conditions {
 		fieldName := util.CamelToLine(key)
@@ -68,26 +68,5 @@ func SearchQuery(db *gorm.DB, search *Search, model interface{}, fuzzyfieldarray
 			db = db.Where(fieldName+" =  ?", str)
 		}
 	}
-	// 排序
-	db = db.Order(search.SortField + " " + search.SortOrder)
-	var result *gorm.DB
-	// 分页处理
-	if isPages {
-		result = db.Count(&count)
-		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return count, result.Error
-		}
-		db = db.Offset((search.PageNum - 1) * search.PageSize).Limit(search.PageSize)
-	}
-	// 钩子处理
-	if isHook {
-		result = db.Find(model)
-	} else {
-		result = db.Session(&gorm.Session{SkipHooks: true}).Find(model)
-	}
-	// 无记录
-	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return 0, result.Error
-	}
-	return count, nil
+	return pageQuery(db, search, model, isPages, isHook)
 }
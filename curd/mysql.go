@@ -1,6 +1,7 @@
 package curd
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/lijianjunljj/gocommon/config"
@@ -12,6 +13,8 @@ var (
 	mysqlInstance *db.Mysql
 	once          sync.Once
 	configs       *config.MysqlOptions
+	// mysqlFromInit 默认连接是否由 Init 设置，是时迁移使用 GetInstance 的数据库
+	mysqlFromInit bool
 
 	AutoMigrateCallFunc func(dst ...interface{}) error
 )
@@ -19,9 +22,11 @@ var (
 func Init(options *config.MysqlOptions) {
 	configs = options
 	WithMysql(Mysql)
+	mysqlFromInit = true
 }
 func WithMysql(mysqlFunc func() *gorm.DB) {
 	mysql = mysqlFunc
+	mysqlFromInit = false
 }
 func Mysql() *gorm.DB {
 	GetInstance()
@@ -35,9 +40,38 @@ func GetInstance() *db.Mysql {
 	return mysqlInstance
 }
 
+// AutoMigrate 同步表结构，模型按绑定的数据库分组迁移，数据库的选择与读写一致，默认数据库优先使用 Init 或 WithMysql 设置的连接
 func AutoMigrate(dst ...interface{}) {
-	GetInstance()
-	mysqlInstance.AutoMigrate(dst...)
+	var names []string
+	groups := make(map[string][]interface{})
+	for _, model := range dst {
+		name := databaseName(model)
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], model)
+	}
+	for _, name := range names {
+		database := lookupDatabase(name)
+		if database == nil {
+			fmt.Println("auto migrate err: 数据库未注册：" + name)
+			continue
+		}
+		database.AutoMigrate(groups[name]...)
+		// 全文索引只支持 MySQL
+		fullText := false
+		switch d := database.(type) {
+		case *db.Mysql:
+			fullText = !d.AutoMigrateDisable
+		case connDatabase:
+			fullText = d.DB().Dialector.Name() == "mysql"
+		}
+		if fullText {
+			if err := MigrateFullText(database.DB(), groups[name]...); err != nil {
+				fmt.Println("fulltext migrate err:", err)
+			}
+		}
+	}
 
 	if AutoMigrateCallFunc != nil {
 		AutoMigrateCallFunc(dst...)
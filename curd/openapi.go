@@ -0,0 +1,328 @@
+package curd
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	resources   []*resource
+	resourcesMu sync.RWMutex
+
+	gormSizeReg = regexp.MustCompile(`(?i)(?:var)?char\((\d+)\)`)
+)
+
+// addResource 记录已注册的资源，用于生成接口文档
+func addResource(r *resource) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	resources = append(resources, r)
+}
+
+// RegisterOpenAPI 挂载 GET /openapi.json 接口文档
+func RegisterOpenAPI(router gin.IRouter, title string, version string) {
+	router.GET("/openapi.json", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, OpenAPI(title, version))
+	})
+}
+
+// OpenAPI 根据已注册的资源生成 OpenAPI 3 文档
+func OpenAPI(title string, version string) map[string]interface{} {
+	resourcesMu.RLock()
+	defer resourcesMu.RUnlock()
+
+	schemas := map[string]interface{}{
+		"Response":        responseSchema(),
+		"Search":          schemaOf(reflect.TypeOf(Search{}), nil),
+		"IDParams":        object(map[string]interface{}{"id": map[string]interface{}{"type": "string"}}),
+		"IDsParams":       object(map[string]interface{}{"ids": array(map[string]interface{}{"type": "string"})}),
+		"BatchResults":    schemaOf(reflect.TypeOf(BatchResults{}), nil),
+		"AuditLog":        schemaOf(reflect.TypeOf(AuditLog{}), nil),
+		"ExportParams":    schemaOf(reflect.TypeOf(ExportParams{}), nil),
+		"ImportResult":    schemaOf(reflect.TypeOf(ImportResult{}), nil),
+		"AggregateParams": schemaOf(reflect.TypeOf(AggregateParams{}), nil),
+	}
+	paths := make(map[string]interface{})
+	for _, r := range resources {
+		name := r.modelType.Name()
+		schemas[name] = schemaOf(r.modelType, nil)
+		model := ref(name)
+		for _, endpoint := range r.endpoints() {
+			request, data := endpointSchemas(endpoint, model)
+			content := jsonContent(envelope(data))
+			if endpoint == EndpointExport {
+				content = map[string]interface{}{
+					exportContentType(ExportCSV):  map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+					exportContentType(ExportXLSX): map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+				}
+			}
+			requestContent := jsonContent(request)
+			if endpoint == EndpointImport {
+				requestContent = map[string]interface{}{
+					"multipart/form-data": map[string]interface{}{"schema": request},
+				}
+			}
+			paths[r.basePath+"/"+string(endpoint)] = map[string]interface{}{
+				"post": map[string]interface{}{
+					"tags":        []string{r.path},
+					"operationId": name + "_" + string(endpoint),
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content":  requestContent,
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "成功",
+							"content":     content,
+						},
+					},
+				},
+			}
+		}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+// endpointSchemas 接口的请求体和响应数据结构
+func endpointSchemas(endpoint Endpoint, model map[string]interface{}) (request, data interface{}) {
+	switch endpoint {
+	case EndpointList, EndpointTrash:
+		pages := schemaOf(reflect.TypeOf(Pages{}), nil)
+		pages["properties"].(map[string]interface{})["data"] = array(model)
+		return ref("Search"), pages
+	case EndpointAll:
+		return ref("Search"), array(model)
+	case EndpointAdd, EndpointEdit, EndpointPatch:
+		return model, model
+	case EndpointBatchAdd, EndpointBatchEdit:
+		params := object(map[string]interface{}{
+			"items":   array(model),
+			"partial": map[string]interface{}{"type": "boolean"},
+		})
+		return params, ref("BatchResults")
+	case EndpointHistory:
+		return ref("IDParams"), array(ref("AuditLog"))
+	case EndpointExport:
+		return ref("ExportParams"), nil
+	case EndpointImport:
+		params := object(map[string]interface{}{
+			"file":   map[string]interface{}{"type": "string", "format": "binary"},
+			"format": map[string]interface{}{"type": "string", "enum": []string{ExportCSV, ExportXLSX}},
+			"dryRun": map[string]interface{}{"type": "boolean"},
+		})
+		params["required"] = []string{"file"}
+		return params, ref("ImportResult")
+	case EndpointAggregate:
+		return ref("AggregateParams"), array(map[string]interface{}{"type": "object"})
+	case EndpointBatchDelete:
+		return ref("IDsParams"), object(map[string]interface{}{"count": map[string]interface{}{"type": "integer"}})
+	default:
+		return ref("IDParams"), model
+	}
+}
+
+// responseSchema 统一响应结构 {code,msg,data}
+func responseSchema() map[string]interface{} {
+	return object(map[string]interface{}{
+		"code": map[string]interface{}{"type": "string", "example": "0000"},
+		"msg":  map[string]interface{}{"type": "string"},
+		"data": map[string]interface{}{},
+	})
+}
+
+// envelope 包装为统一响应结构
+func envelope(data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"allOf": []interface{}{
+			ref("Response"),
+			object(map[string]interface{}{"data": data}),
+		},
+	}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func object(properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func array(items interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+)
+
+// schemaOf 根据结构体的 json、gorm、validate 标签生成数据结构
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType, deletedAtType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{}
+		}
+		return array(schemaOf(t.Elem(), seen))
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+	default:
+		return map[string]interface{}{}
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	if seen[t] {
+		return map[string]interface{}{"type": "object"}
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	properties := make(map[string]interface{})
+	var required []string
+	structFields(t, seen, properties, &required)
+	schema := object(properties)
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// structFields 展开结构体字段，匿名嵌入的结构体字段合并到上层
+func structFields(t reflect.Type, seen map[reflect.Type]bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name := strings.Split(jsonTag, ",")[0]
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType && ft != deletedAtType {
+				structFields(ft, seen, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := schemaOf(field.Type, seen)
+		applyGormTag(schema, field.Tag.Get("gorm"))
+		if applyValidateTag(schema, field.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+}
+
+// applyGormTag 根据 gorm 字段类型补充长度限制
+func applyGormTag(schema map[string]interface{}, tag string) {
+	if tag == "" || schema["type"] != "string" {
+		return
+	}
+	if match := gormSizeReg.FindStringSubmatch(tag); match != nil {
+		size, _ := strconv.Atoi(match[1])
+		schema["maxLength"] = size
+	}
+}
+
+// applyValidateTag 根据 validate 标签补充约束，返回是否必填
+func applyValidateTag(schema map[string]interface{}, tag string) bool {
+	isRequired := false
+	isString := schema["type"] == "string"
+	isArray := schema["type"] == "array"
+	for _, rule := range strings.Split(tag, ",") {
+		key, value := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, value = rule[:i], rule[i+1:]
+		}
+		switch key {
+		case "required":
+			isRequired = true
+		case "email":
+			schema["format"] = "email"
+		case "url":
+			schema["format"] = "uri"
+		case "oneof":
+			schema["enum"] = strings.Fields(value)
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isString:
+				setBound(schema, key, "minLength", "maxLength", int(n))
+			case isArray:
+				setBound(schema, key, "minItems", "maxItems", int(n))
+			default:
+				setBound(schema, key, "minimum", "maximum", n)
+			}
+		}
+	}
+	return isRequired
+}
+
+// setBound 设置上下限
+func setBound(schema map[string]interface{}, key string, minKey string, maxKey string, value interface{}) {
+	switch key {
+	case "min", "gte":
+		schema[minKey] = value
+	case "max", "lte":
+		schema[maxKey] = value
+	case "len":
+		schema[minKey] = value
+		schema[maxKey] = value
+	}
+}
@@ -0,0 +1,261 @@
+package curd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"github.com/lijianjunljj/gocommon/utils/id"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 变更事件类型
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	// EventRestored 从回收站恢复
+	EventRestored = "restored"
+	// EventPurged 从回收站彻底删除
+	EventPurged = "purged"
+)
+
+// 发件箱事件状态
+const (
+	OutboxPending int8 = iota
+	OutboxSent
+)
+
+var (
+	eventsEnabled bool
+
+	// EventTopicPrefix 事件主题前缀，主题为前缀加模型名，如 curd.Order
+	EventTopicPrefix = "curd."
+)
+
+// Publisher 消息发布接口，与 misc.MQ 的 Produce 一致
+type Publisher interface {
+	Produce(queueName string, req interface{}, args map[string]interface{}) error
+}
+
+// Publishable 模型是否发布数据变更事件
+type Publishable interface {
+	PublishEvents() bool
+}
+
+// ChangeEvent 数据变更事件
+type ChangeEvent struct {
+	EventID    string  `json:"event_id"`
+	Type       string  `json:"type"`
+	Model      string  `json:"model"`
+	RecordID   string  `json:"record_id"`
+	Diff       JSONMap `json:"diff"`
+	Actor      string  `json:"actor"`
+	RequestID  string  `json:"request_id"`
+	CreateTime int64   `json:"create_time"`
+}
+
+// OutboxEvent 发件箱事件，与数据变更在同一事务中写入，由 OutboxRelay 发布，需先 AutoMigrate(&OutboxEvent{})
+type OutboxEvent struct {
+	ID         uint64 `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	Topic      string `json:"topic" gorm:"type:varchar(128)"`
+	Payload    string `json:"payload" gorm:"type:text"`
+	Status     int8   `json:"status" gorm:"index"`
+	Attempts   int    `json:"attempts"`
+	LastError  string `json:"last_error" gorm:"type:varchar(255)"`
+	CreateTime int64  `json:"create_time"`
+	SentTime   int64  `json:"sent_time"`
+	// LockedUntil 中继取出后的租约到期时间，到期前其他实例不会重复取出
+	LockedUntil int64 `json:"locked_until"`
+}
+
+// EnableEvents 开启变更事件，实现了 Publishable 的模型在新增、修改、删除，包括批量操作、导入、恢复和彻底删除时写入发件箱
+func EnableEvents() {
+	eventsEnabled = true
+}
+
+// isPublishable 模型是否需要发布变更事件
+func isPublishable(model interface{}) bool {
+	publishable, ok := model.(Publishable)
+	return ok && publishable.PublishEvents() && eventsEnabled
+}
+
+// writeEvent 在事务中写入变更事件，写入失败时事务回滚
+func (l *Logic) writeEvent(tx *gorm.DB, eventType string, model interface{}, before interface{}, after interface{}) error {
+	eventID, err := id.ULID()
+	if err != nil {
+		return err
+	}
+	event := &ChangeEvent{
+		EventID:    eventID,
+		Type:       eventType,
+		Model:      modelName(model),
+		RecordID:   utils.ToStr(reflect.ValueOf(model).Elem().FieldByName("ID").Interface()),
+		Diff:       diffSnapshot(snapshot(before), snapshot(after)),
+		Actor:      l.userID(),
+		CreateTime: utils.TimeUnix(),
+	}
+	if l.svc.Ctx != nil {
+		event.RequestID = l.svc.Ctx.GetHeader("X-Request-ID")
+		if event.RequestID == "" {
+			event.RequestID = l.svc.Ctx.GetString("requestID")
+		}
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if tx == nil {
+		tx = modelDB(model)
+	}
+	return tx.Create(&OutboxEvent{
+		Topic:      EventTopicPrefix + event.Model,
+		Payload:    string(payload),
+		Status:     OutboxPending,
+		CreateTime: event.CreateTime,
+	}).Error
+}
+
+// loadRow 在事务中按ID读取数据范围内的记录，用于变更事件前后对比，读取失败或不在范围内时返回 nil
+func (l *Logic) loadRow(tx *gorm.DB, row interface{}) interface{} {
+	tx = l.eventDB(tx)
+	if applier, ok := l.svc.Model.(scopeApplier); ok {
+		tx = applier.applyScope(tx)
+	}
+	loaded := reflect.New(reflect.TypeOf(row).Elem())
+	loaded.Elem().FieldByName("ID").Set(reflect.ValueOf(row).Elem().FieldByName("ID"))
+	if err := tx.First(loaded.Interface()).Error; err != nil {
+		return nil
+	}
+	return loaded.Interface()
+}
+
+// eventDB 读取变更前后记录的连接，不在事务中时使用模型的数据库
+func (l *Logic) eventDB(tx *gorm.DB) *gorm.DB {
+	if tx != nil {
+		return tx
+	}
+	db := modelDB(l.svc.Model)
+	if l.ctx != nil {
+		db = db.WithContext(l.ctx)
+	}
+	return db
+}
+
+// OutboxRelay 发件箱中继，轮询未发布的事件并发布到消息队列，多实例运行时通过行锁避免重复发布
+type OutboxRelay struct {
+	Publisher Publisher
+	// BatchSize 每次发布的条数，默认 100
+	BatchSize int
+	// Interval 没有事件时的轮询间隔，默认 1 秒
+	Interval time.Duration
+	// MaxAttempts 最大发布次数，超过后不再重试，为 0 时一直重试
+	MaxAttempts int
+	// Args 发布参数，透传给 Produce
+	Args map[string]interface{}
+	// Database 发件箱所在的数据库，为 db.Register 注册的名称，为空时使用默认数据库
+	Database string
+	// Lease 取出事件后的租约时长，需大于发布一批的耗时，中继在发布前退出时租约到期后重新发布，默认 30 秒
+	Lease time.Duration
+}
+
+// NewOutboxRelay 实例化发件箱中继，如 NewOutboxRelay(mq)
+func NewOutboxRelay(publisher Publisher) *OutboxRelay {
+	return &OutboxRelay{Publisher: publisher, BatchSize: 100, Interval: time.Second}
+}
+
+// Run 持续发布事件直到 ctx 取消，一批全部发布成功时立即继续，否则等待轮询间隔
+func (r *OutboxRelay) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil {
+			fmt.Println("outbox relay err:", err)
+		}
+		if err == nil && published == r.batchSize() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// batchSize 每次发布的条数
+func (r *OutboxRelay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return 100
+	}
+	return r.BatchSize
+}
+
+// lease 取出事件后的租约时长
+func (r *OutboxRelay) lease() time.Duration {
+	if r.Lease <= 0 {
+		return 30 * time.Second
+	}
+	return r.Lease
+}
+
+// RelayOnce 取出一批事件并发布，返回发布成功的条数。发布在事务外进行，不会在消息队列阻塞时长时间持有行锁
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	db := databaseDB(r.Database).WithContext(ctx)
+	events, err := r.claim(db)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, event := range events {
+		updates := map[string]interface{}{"attempts": event.Attempts + 1, "locked_until": 0}
+		if err := r.Publisher.Produce(event.Topic, json.RawMessage(event.Payload), r.Args); err != nil {
+			message := []rune(err.Error())
+			if len(message) > 255 {
+				message = message[:255]
+			}
+			updates["last_error"] = string(message)
+		} else {
+			updates["status"] = OutboxSent
+			updates["sent_time"] = utils.TimeUnix()
+			published++
+		}
+		if err := db.Model(&OutboxEvent{}).Where("id = ?", event.ID).Updates(updates).Error; err != nil {
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+// claim 加行锁取出一批未发布且不在租约中的事件，设置租约后提交事务，多实例运行时不会重复取出
+func (r *OutboxRelay) claim(db *gorm.DB) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND locked_until < ?", OutboxPending, now.Unix())
+		if r.MaxAttempts > 0 {
+			query = query.Where("attempts < ?", r.MaxAttempts)
+		}
+		if err := query.Order("id").Limit(r.batchSize()).Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		ids := make([]uint64, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return tx.Model(&OutboxEvent{}).Where("id IN ?", ids).
+			Update("locked_until", now.Add(r.lease()).Unix()).Error
+	})
+	return events, err
+}
@@ -0,0 +1,121 @@
+package curd
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultImmutableFields 默认不允许修改的字段
+var defaultImmutableFields = []string{"id", "create_by", "create_time"}
+
+// PatchAPI 局部更新服务
+type PatchAPI interface {
+	Patch(model interface{}, fields []string) error
+}
+
+// Immutable 模型自定义不允许修改的字段，支持 json 名或列名
+type Immutable interface {
+	ImmutableFields() []string
+}
+
+// immutableFields 不允许修改的字段，包括默认字段、模型自定义字段、数据范围字段和租户字段，防止修改后数据移出数据范围或租户
+func immutableFields(model interface{}, scopeColumn string) []string {
+	immutable := append([]string{}, defaultImmutableFields...)
+	if m, ok := model.(Immutable); ok {
+		immutable = append(immutable, m.ImmutableFields()...)
+	}
+	if _, ok := model.(tenantAware); ok {
+		immutable = append(immutable, TenantColumn)
+	}
+	if scopeColumn != "" {
+		immutable = append(immutable, scopeColumn)
+	}
+	return immutable
+}
+
+// immutableColumns 不允许修改的列名，主键除外
+func immutableColumns(db *gorm.DB, model interface{}, scopeColumn string) ([]string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	immutable := immutableFields(model, scopeColumn)
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.PrimaryKey {
+			continue
+		}
+		name := jsonFieldName(field.Tag.Get("json"), field.Name)
+		if isInArray(name, immutable) || isInArray(field.DBName, immutable) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns, nil
+}
+
+// patchColumns 将请求中出现的 json 字段转换为可更新的列名
+func patchColumns(db *gorm.DB, model interface{}, fields []string, scopeColumn string) ([]string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	immutable := immutableFields(model, scopeColumn)
+	columns := make(map[string]string)
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.PrimaryKey {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if isInArray(name, immutable) || isInArray(field.DBName, immutable) {
+			continue
+		}
+		columns[name] = field.DBName
+	}
+	var selected []string
+	for _, key := range fields {
+		if column, ok := columns[key]; ok && !isInArray(column, selected) {
+			selected = append(selected, column)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("没有可更新的字段")
+	}
+	return selected, nil
+}
+
+// Patch 局部更新，只更新请求中出现的字段
+func (m *Model) Patch(model interface{}, fields []string) error {
+	columns, err := patchColumns(m.conn(), model, fields, m.scopeColumn)
+	if err != nil {
+		return err
+	}
+	if err = m.inScope(m.conn(), model); err != nil {
+		return err
+	}
+	if !isInArray("update_time", columns) {
+		columns = append(columns, "update_time")
+	}
+	if version, ok := versionField(model); ok {
+		if !isInArray("version", columns) {
+			columns = append(columns, "version")
+		}
+		return updateWithVersion(m.conn(), model, version, columns...)
+	}
+	result := m.conn().Model(model).Select(columns).Omit(clause.Associations).Updates(model)
+	return result.Error
+}
+
+// Patch 局部更新，只更新请求中出现的字段
+func (m *ModelIdInt) Patch(model interface{}, fields []string) error {
+	modelBase := m.base()
+	return modelBase.Patch(model, fields)
+}
@@ -0,0 +1,89 @@
+package curd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Includable 模型允许列表查询预加载的关联，如 "Items"、"Items.Product"
+type Includable interface {
+	Includes() []string
+}
+
+// selectFields 校验 Search.Fields 和 Search.Include，只查询指定列，主键和关联外键总是查询
+func selectFields(db *gorm.DB, search *Search, model interface{}) (*gorm.DB, error) {
+	if len(search.Fields) == 0 && len(search.Include) == 0 {
+		return db, nil
+	}
+	if err := db.Statement.Parse(model); err != nil {
+		return db, err
+	}
+	sch := db.Statement.Schema
+
+	if len(search.Include) > 0 {
+		includable, ok := reflect.New(sch.ModelType).Interface().(Includable)
+		if !ok {
+			return db, errors.New("该模型不支持关联查询")
+		}
+		allowed := includable.Includes()
+		for _, include := range search.Include {
+			if !isInArray(include, allowed) {
+				return db, errors.New("关联不存在：" + include)
+			}
+		}
+	}
+	if len(search.Fields) == 0 {
+		return db, nil
+	}
+
+	var columns []string
+	addColumn := func(field *schema.Field) {
+		if field != nil && field.DBName != "" && !isInArray(field.DBName, columns) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, name := range search.Fields {
+		field := sch.LookUpField(name)
+		if field == nil {
+			field = sch.LookUpField(utils.CamelToLine(name))
+		}
+		if field == nil || field.DBName == "" {
+			return db, errors.New("查询字段不存在：" + name)
+		}
+		addColumn(field)
+	}
+	for _, field := range sch.PrimaryFields {
+		addColumn(field)
+	}
+	if search.UseCursor {
+		addColumn(sch.LookUpField(search.SortField))
+	}
+	// 预加载依赖本表的关联键，未选择时也需要查询
+	for _, include := range search.Include {
+		relation, ok := sch.Relationships.Relations[strings.Split(include, ".")[0]]
+		if !ok {
+			continue
+		}
+		for _, ref := range relation.References {
+			if ref.OwnPrimaryKey {
+				addColumn(ref.PrimaryKey)
+			} else if ref.ForeignKey.Schema == sch {
+				addColumn(ref.ForeignKey)
+			}
+		}
+	}
+	return db.Select(columns), nil
+}
+
+// preloadIncludes 预加载 Search.Include 中的关联，需在统计总数之后调用
+func preloadIncludes(db *gorm.DB, search *Search) *gorm.DB {
+	for _, include := range search.Include {
+		db = db.Preload(include)
+	}
+	return db
+}
@@ -0,0 +1,250 @@
+package curd
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lijianjunljj/gocommon/utils"
+)
+
+// Endpoint 资源接口名
+type Endpoint string
+
+const (
+	EndpointList        Endpoint = "list"
+	EndpointAll         Endpoint = "all"
+	EndpointDetail      Endpoint = "detail"
+	EndpointAdd         Endpoint = "add"
+	EndpointEdit        Endpoint = "edit"
+	EndpointPatch       Endpoint = "patch"
+	EndpointDelete      Endpoint = "delete"
+	EndpointTrash       Endpoint = "trash"
+	EndpointRestore     Endpoint = "restore"
+	EndpointPurge       Endpoint = "purge"
+	EndpointBatchAdd    Endpoint = "batchAdd"
+	EndpointBatchEdit   Endpoint = "batchEdit"
+	EndpointBatchDelete Endpoint = "batchDelete"
+	EndpointHistory     Endpoint = "history"
+	EndpointExport      Endpoint = "export"
+	EndpointImport      Endpoint = "import"
+	EndpointAggregate   Endpoint = "aggregate"
+)
+
+// standardEndpoints 默认挂载的接口
+var standardEndpoints = []Endpoint{
+	EndpointList, EndpointAll, EndpointDetail, EndpointAdd, EndpointEdit, EndpointPatch, EndpointDelete,
+}
+
+// trashEndpoints 软删除模型默认挂载的回收站接口
+var trashEndpoints = []Endpoint{
+	EndpointTrash, EndpointRestore, EndpointPurge,
+}
+
+// RegisterOption 资源注册选项
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	enabled     map[Endpoint]bool
+	middlewares map[Endpoint][]gin.HandlerFunc
+	extras      map[Endpoint][]Extra
+	export      ExportConfig
+	hooks       []interface{}
+	isSelf      bool
+	isHook      bool
+}
+
+// WithEndpoints 额外挂载的接口，如批量操作接口
+func WithEndpoints(endpoints ...Endpoint) RegisterOption {
+	return func(o *registerOptions) {
+		for _, endpoint := range endpoints {
+			o.enabled[endpoint] = true
+		}
+	}
+}
+
+// WithoutEndpoints 禁用的接口
+func WithoutEndpoints(endpoints ...Endpoint) RegisterOption {
+	return func(o *registerOptions) {
+		for _, endpoint := range endpoints {
+			o.enabled[endpoint] = false
+		}
+	}
+}
+
+// WithMiddleware 为接口附加中间件
+func WithMiddleware(endpoint Endpoint, handlers ...gin.HandlerFunc) RegisterOption {
+	return func(o *registerOptions) {
+		o.middlewares[endpoint] = append(o.middlewares[endpoint], handlers...)
+	}
+}
+
+// WithExtras 为接口附加处理函数
+func WithExtras(endpoint Endpoint, extras ...Extra) RegisterOption {
+	return func(o *registerOptions) {
+		o.extras[endpoint] = append(o.extras[endpoint], extras...)
+	}
+}
+
+// WithExport 挂载导出接口并设置导出配置
+func WithExport(config ExportConfig) RegisterOption {
+	return func(o *registerOptions) {
+		o.enabled[EndpointExport] = true
+		o.export = config
+	}
+}
+
+// WithHooks 注册模型之外的生命周期钩子
+func WithHooks(hooks ...interface{}) RegisterOption {
+	return func(o *registerOptions) {
+		o.hooks = append(o.hooks, hooks...)
+	}
+}
+
+// WithSelf 强制只操作当前用户的数据，列表接口追加 user_id 条件，详情、修改、删除等接口按 ScopeOwn 数据范围限制
+func WithSelf() RegisterOption {
+	return func(o *registerOptions) {
+		o.isSelf = true
+	}
+}
+
+// WithHook 列表接口执行模型查询钩子
+func WithHook() RegisterOption {
+	return func(o *registerOptions) {
+		o.isHook = true
+	}
+}
+
+// resource 注册的资源
+type resource struct {
+	path       string
+	basePath   string
+	modelType  reflect.Type
+	modelsType reflect.Type
+	options    *registerOptions
+}
+
+// handler 每个请求使用新的模型实例
+func (r *resource) handler() *Handler {
+	h := NewHandler(reflect.New(r.modelType).Interface(), reflect.New(r.modelsType).Interface())
+	return h.WithHooks(r.options.hooks...)
+}
+
+// endpoints 实际挂载的接口
+func (r *resource) endpoints() []Endpoint {
+	candidates := append([]Endpoint{}, standardEndpoints...)
+	candidates = append(candidates, trashEndpoints...)
+	candidates = append(candidates, EndpointBatchAdd, EndpointBatchEdit, EndpointBatchDelete, EndpointHistory, EndpointExport, EndpointImport, EndpointAggregate)
+	model := reflect.New(r.modelType).Interface()
+	soft := isSoftDelete(model)
+	_, audit := model.(Auditable)
+	_, aggregate := model.(Aggregatable)
+	var endpoints []Endpoint
+	for _, endpoint := range candidates {
+		enabled, ok := r.options.enabled[endpoint]
+		if !ok {
+			enabled = endpointInList(endpoint, standardEndpoints) ||
+				(soft && endpointInList(endpoint, trashEndpoints)) ||
+				(audit && endpoint == EndpointHistory) ||
+				(aggregate && endpoint == EndpointAggregate)
+		}
+		if enabled {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// serve 接口处理函数
+func (r *resource) serve(endpoint Endpoint) gin.HandlerFunc {
+	extras := r.options.extras[endpoint]
+	isHook := r.options.isHook
+	return func(ctx *gin.Context) {
+		if r.options.isSelf {
+			// 强制只查询自己的数据时必须有登录用户，避免条件为空查出全部数据
+			if ctx.GetString("userID") == "" {
+				utils.Fail(ctx, errors.New("用户未登录"), utils.CodeTokenExpired)
+				return
+			}
+			ctx.Set("is_self", true)
+		}
+		h := r.handler()
+		switch endpoint {
+		case EndpointList:
+			h.List(ctx, isHook, extras...)
+		case EndpointAll:
+			if isHook {
+				h.AllWithHook(ctx, extras...)
+			} else {
+				h.All(ctx, extras...)
+			}
+		case EndpointDetail:
+			h.Detail(ctx, extras...)
+		case EndpointAdd:
+			h.Add(ctx, extras...)
+		case EndpointEdit:
+			h.Edit(ctx, extras...)
+		case EndpointPatch:
+			h.Patch(ctx, extras...)
+		case EndpointDelete:
+			h.Delete(ctx, extras...)
+		case EndpointTrash:
+			h.Trash(ctx, extras...)
+		case EndpointRestore:
+			h.Restore(ctx, extras...)
+		case EndpointPurge:
+			h.Purge(ctx, extras...)
+		case EndpointBatchAdd:
+			h.BatchAdd(ctx, extras...)
+		case EndpointBatchEdit:
+			h.BatchEdit(ctx, extras...)
+		case EndpointBatchDelete:
+			h.BatchDelete(ctx, extras...)
+		case EndpointHistory:
+			h.History(ctx)
+		case EndpointExport:
+			h.Export(ctx, r.options.export)
+		case EndpointImport:
+			h.Import(ctx, extras...)
+		case EndpointAggregate:
+			h.Aggregate(ctx, extras...)
+		}
+	}
+}
+
+// Register 注册资源的标准增删改查路由，如 POST /orders/list
+func Register(router gin.IRouter, path string, model interface{}, models interface{}, opts ...RegisterOption) gin.IRouter {
+	options := &registerOptions{
+		enabled:     make(map[Endpoint]bool),
+		middlewares: make(map[Endpoint][]gin.HandlerFunc),
+		extras:      make(map[Endpoint][]Extra),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	r := &resource{
+		path:       path,
+		modelType:  reflect.TypeOf(model).Elem(),
+		modelsType: reflect.TypeOf(models).Elem(),
+		options:    options,
+	}
+	group := router.Group(path)
+	r.basePath = group.BasePath()
+	addResource(r)
+	for _, endpoint := range r.endpoints() {
+		handlers := append([]gin.HandlerFunc{}, options.middlewares[endpoint]...)
+		handlers = append(handlers, r.serve(endpoint))
+		group.POST("/"+string(endpoint), handlers...)
+	}
+	return group
+}
+
+// endpointInList 接口是否在列表中
+func endpointInList(endpoint Endpoint, endpoints []Endpoint) bool {
+	for _, item := range endpoints {
+		if item == endpoint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package curd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ScopeAll 全部数据
+	ScopeAll = "all"
+	// ScopeOwn 本人创建的数据
+	ScopeOwn = "own"
+	// ScopeDept 本部门的数据
+	ScopeDept = "dept"
+	// ScopeTenant 本租户的数据
+	ScopeTenant = "tenant"
+	// ScopeAdmin 跨租户的全部数据，仅管理员角色使用，TenantModel 不再限制租户
+	ScopeAdmin = "admin"
+)
+
+// DataScope 数据范围策略，按 Column 字段等于上下文中 Key 的值限制数据，Column 为空表示不限制
+type DataScope struct {
+	Name   string
+	Column string
+	Key    string
+}
+
+// Scoped 模型自定义数据范围字段，返回空时使用策略默认字段
+type Scoped interface {
+	ScopeColumn(scope string) string
+}
+
+// scopeSetter 设置模型查询的数据范围和范围字段，Model 和 ModelIdInt 实现
+type scopeSetter interface {
+	setScope(scope func(db *gorm.DB) *gorm.DB, column string)
+}
+
+var (
+	dataScopes = map[string]DataScope{
+		ScopeAll:    {Name: ScopeAll},
+		ScopeOwn:    {Name: ScopeOwn, Column: "create_by", Key: "userID"},
+		ScopeDept:   {Name: ScopeDept, Column: "dept_id", Key: "deptID"},
+		ScopeTenant: {Name: ScopeTenant, Column: "tenant_id", Key: "tenantID"},
+		ScopeAdmin:  {Name: ScopeAdmin},
+	}
+	roleScopes = make(map[string]string)
+	scopesMu   sync.RWMutex
+
+	// DefaultScope 角色未配置数据范围时使用的策略，为空时不限制
+	DefaultScope = ""
+
+	// scopeResolver 解析请求的数据范围策略名
+	scopeResolver = func(ctx *gin.Context) string {
+		scopesMu.RLock()
+		defer scopesMu.RUnlock()
+		if scope, ok := roleScopes[ctx.GetString("role")]; ok {
+			return scope
+		}
+		return DefaultScope
+	}
+)
+
+// RegisterScope 注册或覆盖数据范围策略
+func RegisterScope(scope DataScope) {
+	scopesMu.Lock()
+	defer scopesMu.Unlock()
+	dataScopes[scope.Name] = scope
+}
+
+// SetRoleScope 设置角色的数据范围策略，角色取上下文中的 role
+func SetRoleScope(role string, scope string) {
+	scopesMu.Lock()
+	defer scopesMu.Unlock()
+	roleScopes[role] = scope
+}
+
+// SetScopeResolver 自定义请求数据范围策略的解析，如一个用户有多个角色时
+func SetScopeResolver(resolver func(ctx *gin.Context) string) {
+	scopeResolver = resolver
+}
+
+// resolveScope 解析请求的数据范围条件，无法确定范围时查询报错，不返回任何数据。
+// column 为数据范围字段，修改时不允许变更；key 标识数据范围，用于区分缓存，不限制时为空
+func resolveScope(ctx *gin.Context, model interface{}) (scope func(db *gorm.DB) *gorm.DB, column string, key string) {
+	name := scopeResolver(ctx)
+	// WithSelf 注册的接口强制只操作本人的数据，不使用角色的数据范围
+	if ctx.GetBool("is_self") {
+		name = ScopeOwn
+	}
+	if name == "" {
+		return nil, "", ""
+	}
+	scopesMu.RLock()
+	dataScope, ok := dataScopes[name]
+	scopesMu.RUnlock()
+	if !ok {
+		return scopeError(errors.New("数据范围策略不存在：" + name)), "", name
+	}
+	if scoped, ok := model.(Scoped); ok {
+		if column := scoped.ScopeColumn(name); column != "" {
+			dataScope.Column = column
+		}
+	}
+	if dataScope.Column == "" {
+		return nil, "", ""
+	}
+	stmt := &gorm.Statement{DB: modelDB(model)}
+	if err := stmt.Parse(model); err != nil {
+		return scopeError(err), "", name
+	}
+	field := stmt.Schema.LookUpField(dataScope.Column)
+	if field == nil || field.DBName == "" {
+		return scopeError(errors.New("数据范围字段不存在：" + dataScope.Column)), "", name
+	}
+	value, _ := ctx.Get(dataScope.Key)
+	rv := reflect.ValueOf(value)
+	if value == nil || rv.IsZero() || (rv.Kind() == reflect.Slice && rv.Len() == 0) {
+		return scopeError(errors.New("无数据权限")), field.DBName, name
+	}
+	key = fmt.Sprintf("%s:%s=%v", name, dataScope.Column, value)
+	col := clause.Column{Table: clause.CurrentTable, Name: dataScope.Column}
+	if rv.Kind() == reflect.Slice {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("? IN ?", col, value)
+		}, field.DBName, key
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{Column: col, Value: value})
+	}, field.DBName, key
+}
+
+// scopeError 数据范围解析失败时让查询返回错误
+func scopeError(err error) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db.AddError(err)
+		return db
+	}
+}
+
+// setScope 设置数据范围
+func (m *Model) setScope(scope func(db *gorm.DB) *gorm.DB, column string) {
+	m.scope = scope
+	m.scopeColumn = column
+}
+
+// setScope 设置数据范围
+func (m *ModelIdInt) setScope(scope func(db *gorm.DB) *gorm.DB, column string) {
+	m.scope = scope
+	m.scopeColumn = column
+}
+
+// scoped 查询附加数据范围条件
+func (m *Model) scoped(db *gorm.DB) *gorm.DB {
+	if m.scope != nil {
+		return db.Scopes(m.scope)
+	}
+	return db
+}
+
+// scopeApplier 在查询上附加数据范围条件，Model 和 ModelIdInt 实现
+type scopeApplier interface {
+	applyScope(db *gorm.DB) *gorm.DB
+}
+
+// applyScope 查询附加数据范围条件
+func (m *Model) applyScope(db *gorm.DB) *gorm.DB {
+	return m.scoped(db)
+}
+
+// applyScope 查询附加数据范围条件
+func (m *ModelIdInt) applyScope(db *gorm.DB) *gorm.DB {
+	return m.base().scoped(db)
+}
+
+// db 附加数据范围条件的数据库连接
+func (m *Model) db() *gorm.DB {
+	return m.scoped(m.conn())
+}
+
+// recordChecker 确认记录存在且可访问，Model 和 ModelIdInt 实现
+type recordChecker interface {
+	exists(model interface{}) error
+}
+
+// exists 确认记录存在且在数据范围和租户内，包括已软删除的记录
+func (m *Model) exists(model interface{}) error {
+	var count int64
+	id := reflect.ValueOf(model).Elem().FieldByName("ID").Interface()
+	result := m.scoped(m.conn()).Unscoped().Model(model).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Count(&count)
+	if result.Error != nil {
+		return result.Error
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// exists 确认记录存在且在数据范围和租户内，包括已软删除的记录
+func (m *ModelIdInt) exists(model interface{}) error {
+	modelBase := m.base()
+	return modelBase.exists(model)
+}
+
+// inScope 写操作前确认记录在数据范围内，防止通过猜测ID修改范围外的数据
+func (m *Model) inScope(db *gorm.DB, model interface{}) error {
+	if m.scope == nil {
+		return nil
+	}
+	var count int64
+	id := reflect.ValueOf(model).Elem().FieldByName("ID").Interface()
+	result := m.scoped(db).Model(model).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Count(&count)
+	if result.Error != nil {
+		return result.Error
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -22,6 +22,8 @@ type Service struct {
 	API       API
 	IDRpc     *client.IDClient
 	GetUnixID func() (string, error)
+	// Hooks 模型之外注册的生命周期钩子
+	Hooks []interface{}
 }
 
 // NewService 实例化服务
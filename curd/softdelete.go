@@ -0,0 +1,108 @@
+package curd
+
+import (
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SoftDeleter 模型是否使用软删除，返回 false 时删除为物理删除
+type SoftDeleter interface {
+	SoftDelete() bool
+}
+
+// TrashAPI 回收站服务
+type TrashAPI interface {
+	Trash(search *Search, isHook bool, models interface{}) (int64, error)
+	Restore(model interface{}) error
+	Purge(model interface{}) error
+}
+
+// SoftModel 支持软删除的基础模型
+type SoftModel struct {
+	Model
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	DeleteBy   string         `json:"delete_by" gorm:"type:varchar(30)"`
+	DeleteTime int64          `json:"delete_time"`
+}
+
+// SoftModelIdInt 支持软删除的自增ID基础模型
+type SoftModelIdInt struct {
+	ModelIdInt
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	DeleteBy   string         `json:"-" gorm:"type:varchar(30)"`
+	DeleteTime int64          `json:"-"`
+}
+
+// SoftDelete 默认开启软删除
+func (m *SoftModel) SoftDelete() bool {
+	return true
+}
+
+// SoftDelete 默认开启软删除
+func (m *SoftModelIdInt) SoftDelete() bool {
+	return true
+}
+
+// isSoftDelete 模型是否开启软删除
+func isSoftDelete(model interface{}) bool {
+	soft, ok := model.(SoftDeleter)
+	return ok && soft.SoftDelete()
+}
+
+// softDelete 软删除，记录删除人和删除时间，记录不存在或已删除时返回 gorm.ErrRecordNotFound
+func softDelete(db *gorm.DB, model interface{}) error {
+	mv := reflect.ValueOf(model).Elem()
+	mv.FieldByName("DeletedAt").Set(reflect.ValueOf(gorm.DeletedAt{Time: time.Now(), Valid: true}))
+	result := db.Model(model).Select("deleted_at", "delete_by", "delete_time").Updates(model)
+	return affected(result)
+}
+
+// Trash 回收站列表查询
+func (m *Model) Trash(search *Search, isHook bool, models interface{}) (int64, error) {
+	db := m.db().Unscoped().Model(models).Where("deleted_at IS NOT NULL")
+	return m.query(db, search, isHook, models, true)
+}
+
+// Restore 恢复软删除的记录
+func (m *Model) Restore(model interface{}) error {
+	result := m.db().Unscoped().Model(model).
+		Where("deleted_at IS NOT NULL").
+		Select("deleted_at", "delete_by", "delete_time").
+		Updates(map[string]interface{}{"deleted_at": nil, "delete_by": "", "delete_time": 0})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge 彻底删除回收站中的记录，记录不存在或不在回收站中时返回 gorm.ErrRecordNotFound
+func (m *Model) Purge(model interface{}) error {
+	if err := m.inScope(m.conn().Unscoped(), model); err != nil {
+		return err
+	}
+	result := m.conn().Unscoped().Where("deleted_at IS NOT NULL").Delete(model)
+	return affected(result)
+}
+
+// Trash 回收站列表查询
+func (m *ModelIdInt) Trash(search *Search, isHook bool, models interface{}) (int64, error) {
+	modelBase := m.base()
+	return modelBase.Trash(search, isHook, models)
+}
+
+// Restore 恢复软删除的记录
+func (m *ModelIdInt) Restore(model interface{}) error {
+	modelBase := m.base()
+	return modelBase.Restore(model)
+}
+
+// Purge 彻底删除回收站中的记录
+func (m *ModelIdInt) Purge(model interface{}) error {
+	modelBase := m.base()
+	return modelBase.Purge(model)
+}
@@ -0,0 +1,200 @@
+package curd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantColumn 租户字段
+const TenantColumn = "tenant_id"
+
+// TenantKey gin 上下文中租户ID的键
+var TenantKey = "tenantID"
+
+// ErrNoTenant 租户模型的操作无法确定租户
+var ErrNoTenant = errors.New("无法确定租户")
+
+// tenantAware 租户模型，TenantModel 实现
+type tenantAware interface {
+	tenantAware()
+}
+
+// TenantModel 共享表的多租户模型，配合 TenantPlugin 新增时自动写入租户ID，查询、修改、删除时自动限制租户
+type TenantModel struct {
+	Model
+	TenantID string `json:"tenant_id" gorm:"type:varchar(30);index"`
+}
+
+func (m *TenantModel) tenantAware() {}
+
+// TenantModelIdInt 自增ID的多租户模型
+type TenantModelIdInt struct {
+	ModelIdInt
+	TenantID string `json:"tenant_id" gorm:"type:varchar(30);index"`
+}
+
+func (m *TenantModelIdInt) tenantAware() {}
+
+type tenantKey struct{}
+
+type ignoreTenantKey struct{}
+
+// WithTenant 在上下文中设置租户ID，用于 gin 请求以外的场景
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// IgnoreTenant 显式跳过租户限制，仅用于管理员跨租户的操作
+func IgnoreTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ignoreTenantKey{}, true)
+}
+
+// TenantFromContext 上下文中的租户ID，第二个返回值表示是否跳过租户限制
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	if ignore, _ := ctx.Value(ignoreTenantKey{}).(bool); ignore {
+		return "", true
+	}
+	if tenantID, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenantID, false
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		if scopeResolver(c) == ScopeAdmin {
+			return "", true
+		}
+		return c.GetString(TenantKey), false
+	}
+	return "", false
+}
+
+// tenantContext 为请求上下文附加租户，角色为管理员范围时跳过租户限制
+func tenantContext(ctx context.Context, c *gin.Context) context.Context {
+	if scopeResolver(c) == ScopeAdmin {
+		return IgnoreTenant(ctx)
+	}
+	if tenantID := c.GetString(TenantKey); tenantID != "" {
+		return WithTenant(ctx, tenantID)
+	}
+	return ctx
+}
+
+// TenantPlugin 多租户插件，对 TenantModel 的新增写入租户ID，查询、修改、删除附加租户条件，
+// 租户从语句的上下文获取，无法确定租户时报错。使用 db.Use(&curd.TenantPlugin{}) 注册，原生 SQL 不受限制
+type TenantPlugin struct{}
+
+// Name 插件名
+func (p *TenantPlugin) Name() string {
+	return "curd:tenant"
+}
+
+// Initialize 注册回调
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("curd:tenant_create", tenantCreate),
+		db.Callback().Query().Before("gorm:query").Register("curd:tenant_query", tenantWhere),
+		db.Callback().Row().Before("gorm:row").Register("curd:tenant_row", tenantWhere),
+		db.Callback().Update().Before("gorm:update").Register("curd:tenant_update", tenantUpdate),
+		db.Callback().Delete().Before("gorm:delete").Register("curd:tenant_delete", tenantWrite),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenantOf 语句是否为租户模型，返回租户ID，跳过限制时 ok 为 false
+func tenantOf(db *gorm.DB) (tenantID string, ok bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return "", false
+	}
+	if _, isTenant := reflect.New(stmt.Schema.ModelType).Interface().(tenantAware); !isTenant {
+		return "", false
+	}
+	tenantID, ignore := TenantFromContext(stmt.Context)
+	if ignore {
+		return "", false
+	}
+	if tenantID == "" {
+		db.AddError(ErrNoTenant)
+		return "", false
+	}
+	return tenantID, true
+}
+
+// tenantCreate 新增时写入当前租户，覆盖请求中传入的租户ID
+func tenantCreate(db *gorm.DB) {
+	tenantID, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField(TenantColumn)
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := field.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(db.Statement.Context, rv, tenantID); err != nil {
+			db.AddError(err)
+		}
+	}
+}
+
+// tenantWhere 附加租户条件
+func tenantWhere(db *gorm.DB) {
+	if tenantID, ok := tenantOf(db); ok && db.Statement.SQL.Len() == 0 {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: TenantColumn}, Value: tenantID},
+		}})
+	}
+}
+
+// tenantUpdate 修改时禁止修改租户ID
+func tenantUpdate(db *gorm.DB) {
+	if _, ok := tenantOf(db); ok {
+		db.Statement.Omits = append(db.Statement.Omits, TenantColumn)
+	}
+	tenantWrite(db)
+}
+
+// tenantWrite 修改和删除附加租户条件，没有条件的全表操作不附加，保留 gorm 的缺少条件检查
+func tenantWrite(db *gorm.DB) {
+	if targetsRows(db.Statement) {
+		tenantWhere(db)
+	}
+}
+
+// targetsRows 语句是否有条件或按主键限定了记录
+func targetsRows(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil {
+		return false
+	}
+	if _, ok := stmt.Clauses["WHERE"]; ok || stmt.AllowGlobalUpdate {
+		return true
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		return stmt.ReflectValue.Len() > 0
+	case reflect.Struct:
+		for _, field := range stmt.Schema.PrimaryFields {
+			if _, isZero := field.ValueOf(stmt.Context, stmt.ReflectValue); !isZero {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,13 +1,22 @@
 package curd
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lijianjunljj/gocommon/db"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// Txn 手动提交的事务，Tx 为空时开启新事务，否则使用传入的事务且不提交，新代码推荐使用 WithTx
 type Txn struct {
-	isCommit bool
-	Tx       *gorm.DB
+	isCommit  bool
+	savepoint string
+	Tx        *gorm.DB
 }
 
 func NewTxn(tx *gorm.DB) *Txn {
@@ -16,6 +25,9 @@ func NewTxn(tx *gorm.DB) *Txn {
 	return that
 }
 func (that *Txn) TryRollback() error {
+	if that.savepoint != "" {
+		return that.Tx.RollbackTo(that.savepoint).Error
+	}
 	if that.isCommit {
 		err := that.Tx.Rollback().Error
 		if err != nil {
@@ -36,7 +48,242 @@ func (that *Txn) TryCommit() error {
 func (that *Txn) PreTxn() {
 	that.isCommit = false
 	if that.Tx == nil {
-		that.Tx = Mysql().Begin().Omit(clause.Associations).Session(&gorm.Session{})
+		that.Tx = beginTx(databaseDB(""))
 		that.isCommit = true
 	}
 }
+
+// NewModelTxn 在模型绑定的数据库上开启新事务
+func NewModelTxn(model interface{}) *Txn {
+	return &Txn{Tx: beginTx(modelDB(model)), isCommit: true}
+}
+
+// beginTx 开启事务，写操作不自动保存关联
+func beginTx(conn *gorm.DB) *gorm.DB {
+	return conn.Begin().Omit(clause.Associations).Session(&gorm.Session{})
+}
+
+// txContextKey 上下文中事务的键，gin.Context 中以字符串键保存
+const txContextKey = "curd.tx"
+
+type txKey struct{}
+
+// txState 上下文中的事务，按数据库名区分，不同数据库的事务通过 parent 串联。
+// 提交后回调在该事务提交后执行，回滚时丢弃
+type txState struct {
+	tx          *gorm.DB
+	name        string
+	parent      *txState
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+// add 注册提交后回调
+func (s *txState) add(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.afterCommit = append(s.afterCommit, fn)
+}
+
+// mark 当前回调数，回滚到保存点时丢弃之后注册的回调
+func (s *txState) mark() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.afterCommit)
+}
+
+// discard 丢弃 mark 之后注册的回调
+func (s *txState) discard(mark int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.afterCommit = s.afterCommit[:mark]
+}
+
+// committed 事务提交后依次执行回调
+func (s *txState) committed() {
+	s.mu.Lock()
+	callbacks := s.afterCommit
+	s.afterCommit = nil
+	s.mu.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+var savepointSeq uint64
+
+// nextSavepoint 生成不重复的保存点名
+func nextSavepoint() string {
+	return fmt.Sprintf("curd_sp_%d", atomic.AddUint64(&savepointSeq, 1))
+}
+
+// TxFromContext 获取上下文中默认数据库的事务，没有时返回 nil
+func TxFromContext(ctx context.Context) *gorm.DB {
+	return DatabaseTxFromContext(ctx, "")
+}
+
+// DatabaseTxFromContext 获取上下文中指定数据库的事务，name 为空时为默认数据库，没有时返回 nil
+func DatabaseTxFromContext(ctx context.Context, name string) *gorm.DB {
+	if state := txStateFor(ctx, name); state != nil {
+		return state.tx
+	}
+	return nil
+}
+
+// txStateFor 获取上下文中指定数据库的事务状态，没有时返回 nil
+func txStateFor(ctx context.Context, name string) *txState {
+	if name == "" {
+		name = db.DefaultName
+	}
+	for state := txStateFromContext(ctx); state != nil; state = state.parent {
+		if state.name == name {
+			return state
+		}
+	}
+	return nil
+}
+
+// txStateFromContext 获取上下文中的事务状态，没有时返回 nil
+func txStateFromContext(ctx context.Context) *txState {
+	if ctx == nil {
+		return nil
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		if c == nil {
+			return nil
+		}
+		if state, ok := c.Get(txContextKey); ok {
+			return state.(*txState)
+		}
+		if c.Request == nil {
+			return nil
+		}
+		ctx = c.Request.Context()
+	}
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state
+}
+
+// AfterCommit 注册事务提交后执行的函数，如删除缓存、发送通知。上下文中有多个数据库的事务时注册在最内层的事务上，
+// 没有事务时立即执行，事务或所在保存点回滚时不执行
+func AfterCommit(ctx context.Context, fn func()) {
+	if state := txStateFromContext(ctx); state != nil {
+		state.add(fn)
+		return
+	}
+	fn()
+}
+
+// afterDatabaseCommit 注册指定数据库的事务提交后执行的函数，上下文中没有该数据库的事务时立即执行
+func afterDatabaseCommit(ctx context.Context, name string, fn func()) {
+	if state := txStateFor(ctx, name); state != nil {
+		state.add(fn)
+		return
+	}
+	fn()
+}
+
+// contextWithTx 把事务放入上下文，gin.Context 直接保存并返回恢复函数
+func contextWithTx(ctx context.Context, state *txState) (context.Context, func()) {
+	if c, ok := ctx.(*gin.Context); ok {
+		prev, exists := c.Get(txContextKey)
+		c.Set(txContextKey, state)
+		return c, func() {
+			if exists {
+				c.Set(txContextKey, prev)
+			} else {
+				delete(c.Keys, txContextKey)
+			}
+		}
+	}
+	return context.WithValue(ctx, txKey{}, state), func() {}
+}
+
+// WithTx 在事务中执行 fn，上下文中已有事务时使用保存点嵌套，fn 返回错误或 panic 时回滚。
+// fn 收到的上下文携带事务，传给 Handler、Logic 或 Model.WithContext 后自动使用该事务
+func WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithDatabaseTx(ctx, "", fn)
+}
+
+// WithDatabaseTx 在指定数据库的事务中执行 fn，name 为 db.Register 注册的名称，为空时使用默认数据库。
+// 上下文中已有同一数据库的事务时使用保存点嵌套，其他数据库的事务不会加入，新开的事务单独提交
+func WithDatabaseTx(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if name == "" {
+		name = db.DefaultName
+	}
+	if state := txStateFor(ctx, name); state != nil {
+		tx := state.tx
+		savepoint := nextSavepoint()
+		if err = tx.SavePoint(savepoint).Error; err != nil {
+			return err
+		}
+		mark := state.mark()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.RollbackTo(savepoint)
+				state.discard(mark)
+				panic(r)
+			}
+			if err != nil {
+				tx.RollbackTo(savepoint)
+				state.discard(mark)
+			}
+		}()
+		return fn(ctx)
+	}
+
+	tx := databaseDB(name).WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	state := &txState{tx: tx, name: name, parent: txStateFromContext(ctx)}
+	txCtx, restore := contextWithTx(ctx, state)
+	defer func() {
+		restore()
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit().Error; err == nil {
+			state.committed()
+		}
+	}()
+	return fn(txCtx)
+}
+
+// contextTxn 上下文中有模型所在数据库的事务时在其中创建保存点，回滚只回滚到保存点，提交由外层事务完成；
+// 否则在模型绑定的数据库上开启新事务
+func contextTxn(ctx context.Context, model interface{}) *Txn {
+	tx := DatabaseTxFromContext(ctx, databaseName(model))
+	if tx == nil {
+		return NewModelTxn(model)
+	}
+	that := &Txn{Tx: tx.Omit(clause.Associations).Session(&gorm.Session{}), savepoint: nextSavepoint()}
+	that.Tx.SavePoint(that.savepoint)
+	return that
+}
+
+// WithContext 查询随上下文取消，上下文中有模型所在数据库的事务时使用该事务，如 model.WithContext(ctx).Detail(model)
+func (m *Model) WithContext(ctx context.Context) *Model {
+	m.ctx = ctx
+	if tx := DatabaseTxFromContext(ctx, m.database); tx != nil {
+		m.tx = tx
+	}
+	return m
+}
+
+// WithContext 查询随上下文取消，上下文中有模型所在数据库的事务时使用该事务
+func (m *ModelIdInt) WithContext(ctx context.Context) *ModelIdInt {
+	m.ctx = ctx
+	if tx := DatabaseTxFromContext(ctx, m.database); tx != nil {
+		m.tx = tx
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package curd
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/lijianjunljj/gocommon/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConflictError 乐观锁版本冲突，数据已被他人修改
+type ConflictError struct {
+	Model   string
+	ID      interface{}
+	Version int64
+}
+
+func (e *ConflictError) Error() string {
+	return "数据已被修改，请刷新后重试"
+}
+
+// ResponseCode 版本冲突响应码
+func (e *ConflictError) ResponseCode() string {
+	return utils.CodeConflict
+}
+
+// versionField 模型的 Version 版本号字段
+func versionField(model interface{}) (reflect.Value, bool) {
+	field := reflect.ValueOf(model).Elem().FieldByName("Version")
+	if !field.IsValid() {
+		return field, false
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return field, true
+	}
+	return field, false
+}
+
+// requireVersion 有版本号的模型修改时请求体必须带版本号，否则合并后使用的是刚读取的版本，乐观锁不生效，缺少时返回参数校验错误
+func requireVersion(ctx *gin.Context, model interface{}) error {
+	if _, ok := versionField(model); !ok {
+		return nil
+	}
+	field, _ := reflect.TypeOf(model).Elem().FieldByName("Version")
+	fields := make(map[string]json.RawMessage)
+	if err := ctx.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		return err
+	}
+	name := jsonFieldName(field.Tag.Get("json"), field.Name)
+	if value, ok := fields[name]; ok && string(value) != "null" {
+		return nil
+	}
+	return utils.FieldErrors{name: name + "为必填字段"}
+}
+
+// updateWithVersion 按版本号更新并递增版本，未更新到数据时返回版本冲突，columns 为空时只更新非零值字段，保留 db 上的 Omit
+func updateWithVersion(db *gorm.DB, model interface{}, version reflect.Value, columns ...string) error {
+	var current int64
+	if version.CanInt() {
+		current = version.Int()
+		version.SetInt(current + 1)
+	} else {
+		current = int64(version.Uint())
+		version.SetUint(uint64(current + 1))
+	}
+	db = db.Model(model).Where("version = ?", current)
+	db = db.Omit(append(db.Statement.Omits, clause.Associations)...)
+	if len(columns) > 0 {
+		db = db.Select(columns)
+	}
+	result := db.Updates(model)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = &ConflictError{
+			Model:   modelName(model),
+			ID:      reflect.ValueOf(model).Elem().FieldByName("ID").Interface(),
+			Version: current,
+		}
+	}
+	if result.Error != nil {
+		if version.CanInt() {
+			version.SetInt(current)
+		} else {
+			version.SetUint(uint64(current))
+		}
+	}
+	return result.Error
+}
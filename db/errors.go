@@ -0,0 +1,113 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+
+	driverMysql "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 数据库错误类型，可用 errors.Is 判断
+var (
+	// ErrDuplicate 唯一索引冲突
+	ErrDuplicate = errors.New("duplicate entry")
+	// ErrForeignKey 外键约束失败
+	ErrForeignKey = errors.New("foreign key constraint fails")
+	// ErrDataTooLong 数据超出字段长度
+	ErrDataTooLong = errors.New("data too long")
+	// ErrDeadlock 死锁，可重试
+	ErrDeadlock = errors.New("deadlock")
+	// ErrNotFound 记录不存在
+	ErrNotFound = errors.New("record not found")
+)
+
+// MySQL 错误号
+const (
+	mysqlDuplicate     = 1062
+	mysqlRowReferenced = 1451
+	mysqlNoReferenced  = 1452
+	mysqlDataTooLong   = 1406
+	mysqlDeadlock      = 1213
+)
+
+var (
+	duplicatePattern  = regexp.MustCompile(`Duplicate entry '(.*)' for key '([^']+)'`)
+	foreignKeyPattern = regexp.MustCompile("FOREIGN KEY \\(`([^`]+)`\\)")
+	columnPattern     = regexp.MustCompile(`for column '([^']+)'`)
+	// MySQL 8 的索引名带表名前缀，如 users.uk_name
+	tablePrefixPattern = regexp.MustCompile(`^.*\.`)
+)
+
+// Error 分类后的数据库错误
+type Error struct {
+	// Kind 错误类型，为 ErrDuplicate 等
+	Kind error
+	// Number 驱动错误号，记录不存在时为 0
+	Number uint16
+	// Field 相关的字段名，唯一索引冲突时为索引名
+	Field string
+	// Value 冲突的值
+	Value string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 支持 errors.Is(err, db.ErrDuplicate)
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Classify 将驱动错误分类为 *Error，无法识别的错误原样返回
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+	var mysqlErr *driverMysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err
+	}
+	e := &Error{Number: mysqlErr.Number, Err: err}
+	switch mysqlErr.Number {
+	case mysqlDuplicate:
+		e.Kind = ErrDuplicate
+		if match := duplicatePattern.FindStringSubmatch(mysqlErr.Message); match != nil {
+			e.Value = match[1]
+			e.Field = tablePrefixPattern.ReplaceAllString(match[2], "")
+		}
+	case mysqlRowReferenced, mysqlNoReferenced:
+		e.Kind = ErrForeignKey
+		if match := foreignKeyPattern.FindStringSubmatch(mysqlErr.Message); match != nil {
+			e.Field = match[1]
+		}
+	case mysqlDataTooLong:
+		e.Kind = ErrDataTooLong
+		if match := columnPattern.FindStringSubmatch(mysqlErr.Message); match != nil {
+			e.Field = match[1]
+		}
+	case mysqlDeadlock:
+		e.Kind = ErrDeadlock
+	default:
+		return err
+	}
+	return e
+}
+
+// IsReferenced 外键约束失败是否因为记录被其他数据引用
+func (e *Error) IsReferenced() bool {
+	return e.Number == mysqlRowReferenced
+}
@@ -0,0 +1,25 @@
+package db
+
+import "sync"
+
+// DefaultName 默认数据库的注册名，未指定数据库的模型使用
+const DefaultName = "default"
+
+var (
+	databases   = make(map[string]AbstractDatabase)
+	databasesMu sync.RWMutex
+)
+
+// Register 按名称注册数据库，同名时覆盖，如 db.Register("order", db.NewMysql(false, options))
+func Register(name string, database AbstractDatabase) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	databases[name] = database
+}
+
+// Get 获取已注册的数据库，未注册时返回 nil
+func Get(name string) AbstractDatabase {
+	databasesMu.RLock()
+	defer databasesMu.RUnlock()
+	return databases[name]
+}
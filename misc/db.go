@@ -15,6 +15,8 @@ func Init(dbType string, configFunc func() interface{}, tables ...interface{}) {
 		conf := configFunc()
 		fmt.Println("conf", conf)
 		DB = db.NewMysql(false, conf.(*config.MysqlOptions))
+		// 注册为默认数据库，curd 的模型未绑定数据库时使用
+		db.Register(db.DefaultName, DB)
 		DB.AutoMigrate(tables...)
 	}
 }
@@ -28,3 +28,14 @@ func (c *IDClient) GetUnixID() (string, error) {
 	l := logic.NewIDLogic(svc)
 	return util.Int64ToStr(l.GetUnixID()), nil
 }
+
+// GetUnixIDs 批量获取时间戳ID
+func (c *IDClient) GetUnixIDs(n int) ([]string, error) {
+	svc := service.NewIDService()
+	l := logic.NewIDLogic(svc)
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ids = append(ids, util.Int64ToStr(l.GetUnixID()))
+	}
+	return ids, nil
+}
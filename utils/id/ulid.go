@@ -0,0 +1,64 @@
+package id
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// crockford ULID 使用的 Crockford Base32 字符表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu      sync.Mutex
+	ulidLastMs  uint64
+	ulidEntropy [10]byte
+)
+
+// ULID 生成26位按时间排序的唯一ID，前48位为毫秒时间戳，后80位随机，同一毫秒内随机部分递增保证单调
+func ULID() (string, error) {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms > ulidLastMs {
+		if _, err := rand.Read(ulidEntropy[:]); err != nil {
+			return "", err
+		}
+		ulidLastMs = ms
+	} else {
+		// 时钟未前进时沿用上次的时间戳并递增随机部分
+		ms = ulidLastMs
+		for i := len(ulidEntropy) - 1; i >= 0; i-- {
+			ulidEntropy[i]++
+			if ulidEntropy[i] != 0 {
+				break
+			}
+		}
+	}
+
+	var data [16]byte
+	for i := 0; i < 6; i++ {
+		data[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(data[6:], ulidEntropy[:])
+	return encodeULID(data), nil
+}
+
+// encodeULID 128位数据按每5位一个字符编码，首字符只有3位有效
+func encodeULID(data [16]byte) string {
+	out := make([]byte, 26)
+	var acc uint32
+	bits := 2 // 128 位补齐到 130 位，首字符高位补 0
+	n := 0
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[n] = crockford[(acc>>uint(bits))&0x1f]
+			n++
+		}
+	}
+	return string(out)
+}
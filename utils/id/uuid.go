@@ -0,0 +1,12 @@
+package id
+
+import "github.com/google/uuid"
+
+// UUIDv7 生成按时间排序的 UUID v7
+func UUIDv7() (string, error) {
+	u, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -19,8 +20,29 @@ const (
 	CodeTokenExpired = "1002"
 	//CodeException 系统异常响应码
 	CodeException = "1003"
+	//CodeConflict 数据版本冲突响应码
+	CodeConflict = "1004"
+	//CodeInvalid 参数校验失败响应码
+	CodeInvalid = "1005"
+	//CodeDuplicate 数据重复响应码
+	CodeDuplicate = "1006"
+	//CodeReference 关联数据约束失败响应码
+	CodeReference = "1007"
+	//CodeTooLong 数据超出长度响应码
+	CodeTooLong = "1008"
+	//CodeRetry 数据库繁忙可重试响应码
+	CodeRetry = "1009"
+	//CodeNotFound 数据不存在响应码
+	CodeNotFound = "1010"
+	//CodeProcessing 请求处理中响应码
+	CodeProcessing = "1011"
 )
 
+// ResponseCoder 自带响应码的错误
+type ResponseCoder interface {
+	ResponseCode() string
+}
+
 // Response 响应结构体
 type Response struct {
 	Code    string      `json:"code"`
@@ -45,8 +67,11 @@ func Fail(ctx *gin.Context, err error, codes ...string) {
 	code := CodeFail
 	msg := err.Error()
 	fmt.Println(err, msg)
+	var coder ResponseCoder
 	if len(codes) > 0 {
 		code = codes[0]
+	} else if errors.As(err, &coder) {
+		code = coder.ResponseCode()
 	}
 	if _, isValidationErrors := err.(validator.ValidationErrors); isValidationErrors {
 		msg = err.Error() // "参数校验不通过"
@@ -58,9 +83,14 @@ func Fail(ctx *gin.Context, err error, codes ...string) {
 		errs := strings.Split(msg, "=")
 		msg = errs[len(errs)-1]
 	}
+	var data interface{} = err.Error()
+	var fieldErrors FieldErrors
+	if errors.As(err, &fieldErrors) {
+		data = fieldErrors
+	}
 	ctx.JSON(200, Response{
 		Code:    code,
 		Message: msg,
-		Data:    err.Error(),
+		Data:    data,
 	})
 }
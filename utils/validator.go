@@ -2,6 +2,11 @@ package utils
 
 import (
 	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
 	"gopkg.in/go-playground/validator.v9"
 
 	"github.com/gin-gonic/gin"
@@ -13,12 +18,52 @@ import (
 var validate *validator.Validate
 var validateTrans ut.Translator
 
+const (
+	// ValidateCreate 新增时的校验分组，规则写在 validate_create 标签
+	ValidateCreate = "create"
+	// ValidateUpdate 修改时的校验分组，规则写在 validate_update 标签
+	ValidateUpdate = "update"
+)
+
+// groupValidator 按标签名创建的校验器及其翻译器
+type groupValidator struct {
+	validate *validator.Validate
+	trans    ut.Translator
+}
+
+var (
+	groupValidators   = make(map[string]*groupValidator)
+	groupValidatorsMu sync.Mutex
+)
+
+// FieldErrors 参数校验错误，字段名到错误信息
+type FieldErrors map[string]string
+
+// Error 按字段名排序拼接错误信息
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, e[field])
+	}
+	return strings.Join(msgs, "；")
+}
+
+// ResponseCode 参数校验失败响应码
+func (e FieldErrors) ResponseCode() string {
+	return CodeInvalid
+}
+
 // InitValid 初始化校验器
 func InitValid() {
 	zh_ch := zh.New()
 	validate = validator.New()
 	uni := ut.New(zh_ch)
-	validateTrans, _ := uni.GetTranslator("zh")
+	validateTrans, _ = uni.GetTranslator("zh")
 	//验证器注册翻译器
 	zh_translations.RegisterDefaultTranslations(validate, validateTrans)
 	// 注册自定义验证
@@ -27,14 +72,19 @@ func InitValid() {
 
 // Validate 参数校验
 func Validate(s interface{}, ctx *gin.Context) error {
-	if validate == nil {
-		InitValid()
-	}
 	_, err := Bind(ctx, s)
 	if err != nil {
 		return err
 	}
-	if err = validate.Struct(s); err != nil {
+	return ValidateStruct(s)
+}
+
+// ValidateStruct 校验结构体，返回第一条错误信息
+func ValidateStruct(s interface{}) error {
+	if validate == nil {
+		InitValid()
+	}
+	if err := validate.Struct(s); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			return errors.New(err.Translate(validateTrans))
 		}
@@ -43,6 +93,112 @@ func Validate(s interface{}, ctx *gin.Context) error {
 	return nil
 }
 
+// ValidateGroup 按分组校验结构体，先校验 validate 标签，再校验 validate_{group} 标签，
+// 失败时返回以 json 字段名为键的 FieldErrors
+func ValidateGroup(s interface{}, group string) error {
+	errs := make(FieldErrors)
+	for _, tag := range []string{"validate", "validate_" + group} {
+		v := getGroupValidator(tag)
+		err := v.validate.Struct(s)
+		if err == nil {
+			continue
+		}
+		validationErrors, ok := err.(validator.ValidationErrors)
+		if !ok {
+			return err
+		}
+		for _, fieldErr := range validationErrors {
+			field := fieldPath(reflect.TypeOf(s), fieldErr)
+			if _, exists := errs[field]; !exists {
+				errs[field] = fieldErr.Translate(v.trans)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidatePartial 按分组校验结构体，只保留 fields 中字段的错误，用于局部更新时只校验提交的字段
+func ValidatePartial(s interface{}, group string, fields []string) error {
+	err := ValidateGroup(s, group)
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		return err
+	}
+	partial := make(FieldErrors)
+	for field, msg := range errs {
+		name := strings.SplitN(field, ".", 2)[0]
+		if i := strings.Index(name, "["); i >= 0 {
+			name = name[:i]
+		}
+		for _, f := range fields {
+			if f == name {
+				partial[field] = msg
+				break
+			}
+		}
+	}
+	if len(partial) > 0 {
+		return partial
+	}
+	return nil
+}
+
+// fieldPath 错误字段的 json 路径，去掉顶层结构体名和匿名嵌入的结构体名，如 items[0].name
+func fieldPath(typ reflect.Type, fieldErr validator.FieldError) string {
+	names := strings.Split(fieldErr.Namespace(), ".")[1:]
+	structNames := strings.Split(fieldErr.StructNamespace(), ".")[1:]
+	path := make([]string, 0, len(names))
+	for i, name := range names {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() == reflect.Struct && i < len(structNames) {
+			structName := structNames[i]
+			if j := strings.Index(structName, "["); j >= 0 {
+				structName = structName[:j]
+			}
+			if field, ok := typ.FieldByName(structName); ok {
+				typ = field.Type
+				if field.Anonymous {
+					continue
+				}
+			}
+		}
+		path = append(path, name)
+	}
+	return strings.Join(path, ".")
+}
+
+// getGroupValidator 获取按标签名校验的校验器，字段名使用 json 标签。
+// 每个校验器使用独立的翻译器，避免重复注册翻译冲突
+func getGroupValidator(tag string) *groupValidator {
+	groupValidatorsMu.Lock()
+	defer groupValidatorsMu.Unlock()
+	if v, ok := groupValidators[tag]; ok {
+		return v
+	}
+	v := &groupValidator{validate: validator.New()}
+	v.validate.SetTagName(tag)
+	v.validate.RegisterTagNameFunc(jsonFieldName)
+	v.trans, _ = ut.New(zh.New()).GetTranslator("zh")
+	zh_translations.RegisterDefaultTranslations(v.validate, v.trans)
+	v.validate.RegisterValidation("nameValid", nameValid)
+	groupValidators[tag] = v
+	return v
+}
+
+// jsonFieldName 校验错误中使用 json 字段名
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
 // 自定义校验函数
 func nameValid(fl validator.FieldLevel) bool {
 	val := fl.Field().String()